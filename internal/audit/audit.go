@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionNoteCreate = "note.create"
+	ActionNoteUpdate = "note.update"
+	ActionNoteDelete = "note.delete"
+	ActionNoteImport = "note.import"
+)
+
+// Info holds the request metadata attached to every audit event
+type Info struct {
+	RequestID string
+	IP        string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given request metadata
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the request metadata stored in ctx, if any
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(contextKey{}).(Info)
+	return info
+}
+
+// Change describes how a single field changed
+type Change struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+// Diff returns a JSON object with one entry per top-level field that differs
+// between before and after. Either side may be nil for creates and deletes.
+func Diff(before, after any) (json.RawMessage, error) {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for key, oldValue := range beforeFields {
+		newValue, ok := afterFields[key]
+		if !ok {
+			changes[key] = Change{Old: oldValue}
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = Change{Old: oldValue, New: newValue}
+		}
+	}
+	for key, newValue := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			changes[key] = Change{New: newValue}
+		}
+	}
+
+	return json.Marshal(changes)
+}
+
+// toFields converts v into a map of its top-level JSON fields
+func toFields(v any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit value: %w", err)
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode audit value: %w", err)
+	}
+	return fields, nil
+}
@@ -1,14 +1,28 @@
 package config
 
 import (
+	"fmt"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	ServerPort string
+	GRPCPort   string
 	DB         DatabaseConfig
+	// IdempotencyTTL is how long responses to idempotent requests are kept
+	IdempotencyTTL time.Duration
+	// EventsReplaySize is how many note change events are kept for clients resuming the stream
+	EventsReplaySize int
+	// MaxBatchOperations is the largest number of operations a note batch may contain
+	MaxBatchOperations int
+	// WebhookAllowedNetworks are the non-public networks webhooks may still be sent to
+	WebhookAllowedNetworks []netip.Prefix
 }
 
 type DatabaseConfig struct {
@@ -25,8 +39,34 @@ func Load() (*Config, error) {
 	// Load .env file if it exists
 	godotenv.Load()
 
+	idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: %w", err)
+	}
+	if idempotencyTTL <= 0 {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: must be a positive duration")
+	}
+
+	eventsReplaySize, err := strconv.Atoi(getEnv("EVENTS_REPLAY_SIZE", "1000"))
+	if err != nil || eventsReplaySize < 1 {
+		return nil, fmt.Errorf("invalid EVENTS_REPLAY_SIZE: must be a positive integer")
+	}
+
+	// Batch requests are also bounded by the 1 MiB body limit, which fits
+	// roughly 15,000 of the smallest operations
+	maxBatchOperations, err := strconv.Atoi(getEnv("BATCH_MAX_OPERATIONS", "5000"))
+	if err != nil || maxBatchOperations < 1 {
+		return nil, fmt.Errorf("invalid BATCH_MAX_OPERATIONS: must be a positive integer")
+	}
+
+	webhookAllowedNetworks, err := parseNetworks(getEnv("WEBHOOK_ALLOWED_NETWORKS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_ALLOWED_NETWORKS: %w", err)
+	}
+
 	return &Config{
 		ServerPort: getEnv("PORT", "8080"),
+		GRPCPort:   getEnv("GRPC_PORT", "9090"),
 		DB: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
@@ -35,9 +75,34 @@ func Load() (*Config, error) {
 			DBName:   getEnv("DB_NAME", "noter"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		IdempotencyTTL:         idempotencyTTL,
+		EventsReplaySize:       eventsReplaySize,
+		MaxBatchOperations:     maxBatchOperations,
+		WebhookAllowedNetworks: webhookAllowedNetworks,
 	}, nil
 }
 
+// parseNetworks reads a comma-separated list of CIDR prefixes or single addresses
+func parseNetworks(value string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		network, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks, nil
+}
+
 // Get any env var from the .env file by key
 func getEnv(key string, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
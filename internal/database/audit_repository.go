@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// AuditFilter narrows down the audit events returned by a query
+type AuditFilter struct {
+	NoteID *uuid.UUID
+	Action string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// AuditRepository handles database operations for audit events
+type AuditRepository struct {
+	db *DB
+}
+
+// NewAuditRepository creates a new audit repository
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+// ListEvents retrieves the audit events matching the filter, newest first
+func (r *AuditRepository) ListEvents(ctx context.Context, filter AuditFilter) ([]*models.AuditEvent, error) {
+	events := []*models.AuditEvent{}
+	err := r.StreamEvents(ctx, filter, func(event *models.AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// StreamEvents calls fn for every audit event matching the filter, newest first,
+// without loading the whole result set into memory
+func (r *AuditRepository) StreamEvents(ctx context.Context, filter AuditFilter, fn func(*models.AuditEvent) error) error {
+	var conditions []string
+	var args []any
+	addCondition := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.NoteID != nil {
+		addCondition("note_id = $%d", *filter.NoteID)
+	}
+	if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+
+	query := `
+		SELECT id, action, note_id, request_id, ip, diff, created_at
+		FROM audit_events
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := rows.Scan(&event.ID, &event.Action, &event.NoteID, &event.RequestID, &event.IP, &event.Diff, &event.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating audit events: %w", err)
+	}
+
+	return nil
+}
+
+// insertAuditEventQuery writes a single audit event row
+const insertAuditEventQuery = `
+	INSERT INTO audit_events (action, note_id, request_id, ip, diff)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+`
+
+// recordAuditEvent writes an audit event within the transaction of the change it describes
+func recordAuditEvent(ctx context.Context, tx pgx.Tx, action string, noteID uuid.UUID, before, after any) (*models.AuditEvent, error) {
+	event, err := newAuditEvent(ctx, action, noteID, before, after)
+	if err != nil {
+		return nil, err
+	}
+	return event, insertAuditEvent(ctx, tx, event)
+}
+
+// insertAuditEvent writes a built audit event, filling in its ID and time
+func insertAuditEvent(ctx context.Context, tx pgx.Tx, event *models.AuditEvent) error {
+	err := tx.QueryRow(ctx, insertAuditEventQuery, event.Action, event.NoteID, event.RequestID, event.IP, event.Diff).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// queueAuditEvent adds an audit event to a batch sent within the transaction
+// of the change it describes. The returned event is complete once the batch
+// has been sent.
+func queueAuditEvent(ctx context.Context, batch *pgx.Batch, action string, noteID uuid.UUID, before, after any) (*models.AuditEvent, error) {
+	event, err := newAuditEvent(ctx, action, noteID, before, after)
+	if err != nil {
+		return nil, err
+	}
+	batch.Queue(insertAuditEventQuery, event.Action, event.NoteID, event.RequestID, event.IP, event.Diff).QueryRow(func(row pgx.Row) error {
+		return row.Scan(&event.ID, &event.CreatedAt)
+	})
+	return event, nil
+}
+
+// newAuditEvent builds the audit event of a change, before it is written
+func newAuditEvent(ctx context.Context, action string, noteID uuid.UUID, before, after any) (*models.AuditEvent, error) {
+	diff, err := audit.Diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+	info := audit.FromContext(ctx)
+	return &models.AuditEvent{
+		Action:    action,
+		NoteID:    &noteID,
+		RequestID: info.RequestID,
+		IP:        info.IP,
+		Diff:      diff,
+	}, nil
+}
+
+// EventsByNoteIDs retrieves the newest limit audit events of each of
+// several notes in a single query, grouped by note and newest first
+func (r *AuditRepository) EventsByNoteIDs(ctx context.Context, ids []uuid.UUID, limit int) (map[uuid.UUID][]*models.AuditEvent, error) {
+	query := `
+		SELECT events.id, events.action, events.note_id, events.request_id, events.ip, events.diff, events.created_at
+		FROM unnest($1::uuid[]) AS notes(id)
+		CROSS JOIN LATERAL (
+			SELECT id, action, note_id, request_id, ip, diff, created_at
+			FROM audit_events
+			WHERE note_id = notes.id
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		) events
+		ORDER BY events.created_at DESC, events.id DESC
+	`
+	rows, err := r.db.conn(ctx).Query(ctx, query, ids, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make(map[uuid.UUID][]*models.AuditEvent)
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := rows.Scan(&event.ID, &event.Action, &event.NoteID, &event.RequestID, &event.IP, &event.Diff, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events[*event.NoteID] = append(events[*event.NoteID], &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit events: %w", err)
+	}
+
+	return events, nil
+}
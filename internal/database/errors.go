@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/moabdelazem/noter/internal/audit"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write clashes with an existing record
+	ErrConflict = errors.New("conflict")
+	// ErrBatchAborted is reported for the operations of an atomic batch that
+	// were rolled back or skipped because another operation failed
+	ErrBatchAborted = errors.New("batch aborted")
+	// ErrInternal is reported to clients in place of errors that are not
+	// part of the domain, so their details never leave the server
+	ErrInternal = errors.New("internal error")
+)
+
+// Internal logs an error that is not part of the domain with the request
+// ID of ctx and returns ErrInternal to report to the client instead
+func Internal(ctx context.Context, err error) error {
+	log.Printf("request %s: %v", audit.FromContext(ctx).RequestID, err)
+	return ErrInternal
+}
+
+// FieldError describes a single invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a record is rejected because of its contents
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return "validation failed: " + strings.Join(messages, ", ")
+}
+
+// Postgres error codes mapped to domain errors
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgNotNullViolation    = "23502"
+	pgCheckViolation      = "23514"
+	pgStringTooLong       = "22001"
+	pgInvalidText         = "22P02"
+)
+
+// mapError translates driver errors into the domain errors above, keeping
+// the original error in the chain for logging
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation, pgForeignKeyViolation:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case pgNotNullViolation:
+		return columnError(pgErr, "is required")
+	case pgStringTooLong:
+		return columnError(pgErr, "is too long")
+	case pgCheckViolation, pgInvalidText:
+		return columnError(pgErr, "is invalid")
+	}
+	return err
+}
+
+// columnError builds a validation error for the column a Postgres error refers to
+func columnError(pgErr *pgconn.PgError, message string) *ValidationError {
+	field := pgErr.ColumnName
+	if field == "" {
+		// Postgres does not name the column for every kind of error
+		field = "value"
+	}
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: message}}}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// errNotStored rolls back a request whose response is not to be stored
+var errNotStored = errors.New("idempotent response not stored")
+
+// IdempotencyRepository handles database operations for idempotency keys
+type IdempotencyRepository struct {
+	db *DB
+}
+
+// NewIdempotencyRepository creates a new idempotency repository
+func NewIdempotencyRepository(db *DB) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		db: db,
+	}
+}
+
+// Claim reserves an idempotency key for a request about to run by storing
+// it as in progress until lease has passed. It reports false when the key
+// is already held, by a request still running or by a stored response.
+// Expired keys are taken over.
+func (r *IdempotencyRepository) Claim(ctx context.Context, key string, lease time.Duration) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (key, fingerprint, status_code, headers, body, completed, created_at, expires_at)
+		VALUES ($1, '', 0, '{}', '', FALSE, NOW(), NOW() + $2::interval)
+		ON CONFLICT (key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+			status_code = EXCLUDED.status_code,
+			headers = EXCLUDED.headers,
+			body = EXCLUDED.body,
+			completed = EXCLUDED.completed,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING key
+	`
+	err := r.db.Pool.QueryRow(ctx, query, key, lease).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %w", mapError(err))
+	}
+	return true, nil
+}
+
+// PurgeExpired deletes the expired idempotency keys
+func (r *IdempotencyRepository) PurgeExpired(ctx context.Context) error {
+	if _, err := r.db.Pool.Exec(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= NOW()"); err != nil {
+		return fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return nil
+}
+
+// GetResponse retrieves an unexpired idempotency key, which holds the
+// stored response once its request has completed
+func (r *IdempotencyRepository) GetResponse(ctx context.Context, key string) (*models.IdempotentResponse, error) {
+	query := `
+		SELECT key, fingerprint, status_code, headers, body, completed, created_at, expires_at
+		FROM idempotency_keys
+		WHERE key = $1 AND expires_at > NOW()
+	`
+	var resp models.IdempotentResponse
+	err := r.db.Pool.QueryRow(ctx, query, key).Scan(
+		&resp.Key, &resp.Fingerprint, &resp.StatusCode, &resp.Headers, &resp.Body, &resp.Completed, &resp.CreatedAt, &resp.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotent response: %w", mapError(err))
+	}
+	return &resp, nil
+}
+
+// Complete runs the request holding a claimed idempotency key and stores
+// its response until ttl has passed. fn is given a context carrying a
+// transaction that every repository joins, and the response it returns is
+// stored in that same transaction, so the changes made by the request and
+// its response are committed together or not at all. A nil response rolls
+// the transaction back and stores nothing.
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) (*models.IdempotentResponse, error)) error {
+	err := r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		txCtx, state := withTx(ctx, tx)
+		resp, err := fn(txCtx)
+		if err != nil {
+			return err
+		}
+		if resp == nil {
+			return errNotStored
+		}
+
+		query := `
+			UPDATE idempotency_keys
+			SET fingerprint = $2,
+				status_code = $3,
+				headers = $4,
+				body = $5,
+				completed = TRUE,
+				expires_at = NOW() + $6::interval
+			WHERE key = $1 AND NOT completed
+		`
+		tag, err := tx.Exec(ctx, query, key, resp.Fingerprint, resp.StatusCode, resp.Headers, resp.Body, ttl)
+		if err != nil {
+			return fmt.Errorf("failed to save idempotent response: %w", mapError(err))
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("failed to save idempotent response: %w", ErrNotFound)
+		}
+		if state.notesChanged {
+			return bumpNotesVersion(ctx, tx)
+		}
+		return nil
+	})
+	if errors.Is(err, errNotStored) {
+		return nil
+	}
+	return err
+}
+
+// Release gives up the claim on an idempotency key whose request did not
+// complete, so the request can be retried
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := r.db.Pool.Exec(ctx, "DELETE FROM idempotency_keys WHERE key = $1 AND NOT completed", key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
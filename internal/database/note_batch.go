@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// Batch operation kinds
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchOperation is a single write within a note batch. Create operations
+// carry the note to insert, updates the note ID and its new title, and
+// deletes only the note ID.
+type BatchOperation struct {
+	Op    string
+	ID    uuid.UUID
+	Title string
+	Note  *models.Note
+}
+
+// BatchResult is the outcome of a single batch operation. Note holds the
+// created or updated note, or the note as it was before it was deleted.
+type BatchResult struct {
+	Note *models.Note
+	Err  error
+}
+
+// ExecBatch runs a list of note writes. Atomic batches are applied in a
+// single transaction with their statements pipelined through pgx.Batch, and
+// either every operation is committed or none is. Otherwise each operation
+// runs in its own transaction so the others still apply when one fails.
+// The returned error is only set when the batch could not be run at all.
+func (r *NoteRepository) ExecBatch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	if atomic {
+		return r.execAtomicBatch(ctx, ops)
+	}
+
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i].Note, results[i].Err = r.execOperation(ctx, op)
+	}
+	return results, nil
+}
+
+// execOperation runs a single batch operation in its own transaction
+func (r *NoteRepository) execOperation(ctx context.Context, op BatchOperation) (*models.Note, error) {
+	switch op.Op {
+	case BatchCreate:
+		if err := r.CreateNote(ctx, op.Note); err != nil {
+			return nil, err
+		}
+		return op.Note, nil
+	case BatchUpdate:
+		return r.UpdateNote(ctx, op.ID, func(note *models.Note) error {
+			note.Title = op.Title
+			return nil
+		})
+	case BatchDelete:
+		return r.deleteNote(ctx, op.ID)
+	default:
+		return nil, fmt.Errorf("unknown batch operation %q", op.Op)
+	}
+}
+
+// execAtomicBatch applies every operation in one transaction using two round
+// trips: one pipelining the note writes, one pipelining their audit events
+func (r *NoteRepository) execAtomicBatch(ctx context.Context, ops []BatchOperation) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	failed := -1
+
+	err := r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		now := time.Now()
+		writes := &pgx.Batch{}
+		for _, op := range ops {
+			switch op.Op {
+			case BatchCreate:
+				writes.Queue(`
+					INSERT INTO notes (id, title, created_at, updated_at)
+					VALUES ($1, $2, $3, $4)
+					RETURNING id, title, created_at, updated_at
+				`, op.Note.ID, op.Note.Title, op.Note.CreatedAt, op.Note.UpdatedAt)
+			case BatchUpdate:
+				writes.Queue(`
+					WITH before AS (
+						SELECT id, title, created_at, updated_at
+						FROM notes
+						WHERE id = $1
+						FOR UPDATE
+					)
+					UPDATE notes
+					SET title = $2, updated_at = $3
+					FROM before
+					WHERE notes.id = before.id
+					RETURNING before.id, before.title, before.created_at, before.updated_at, notes.title, notes.updated_at
+				`, op.ID, op.Title, now)
+			case BatchDelete:
+				writes.Queue(`
+					DELETE FROM notes
+					WHERE id = $1
+					RETURNING id, title, created_at, updated_at
+				`, op.ID)
+			default:
+				return fmt.Errorf("unknown batch operation %q", op.Op)
+			}
+		}
+
+		befores := make([]*models.Note, len(ops))
+		br := tx.SendBatch(ctx, writes)
+		for i, op := range ops {
+			var before, after models.Note
+			var err error
+			switch op.Op {
+			case BatchCreate:
+				err = br.QueryRow().Scan(&after.ID, &after.Title, &after.CreatedAt, &after.UpdatedAt)
+			case BatchUpdate:
+				err = br.QueryRow().Scan(&before.ID, &before.Title, &before.CreatedAt, &before.UpdatedAt, &after.Title, &after.UpdatedAt)
+				after.ID, after.CreatedAt = before.ID, before.CreatedAt
+			case BatchDelete:
+				err = br.QueryRow().Scan(&before.ID, &before.Title, &before.CreatedAt, &before.UpdatedAt)
+			}
+			if err != nil {
+				failed = i
+				results[i].Err = fmt.Errorf("failed to %s note: %w", op.Op, mapError(err))
+				br.Close()
+				return results[i].Err
+			}
+
+			if op.Op == BatchDelete {
+				results[i].Note = &before
+			} else {
+				results[i].Note = &after
+			}
+			if op.Op != BatchCreate {
+				befores[i] = &before
+			}
+		}
+		if err := br.Close(); err != nil {
+			return fmt.Errorf("failed to apply batch: %w", mapError(err))
+		}
+
+		audits := &pgx.Batch{}
+		recorded := make([]*models.AuditEvent, len(ops))
+		for i, op := range ops {
+			var err error
+			switch op.Op {
+			case BatchCreate:
+				recorded[i], err = queueAuditEvent(ctx, audits, audit.ActionNoteCreate, results[i].Note.ID, nil, results[i].Note)
+			case BatchUpdate:
+				recorded[i], err = queueAuditEvent(ctx, audits, audit.ActionNoteUpdate, op.ID, befores[i], results[i].Note)
+			case BatchDelete:
+				recorded[i], err = queueAuditEvent(ctx, audits, audit.ActionNoteDelete, op.ID, befores[i], nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.SendBatch(ctx, audits).Close(); err != nil {
+			return fmt.Errorf("failed to record audit events: %w", err)
+		}
+
+		events := make([]*noteEvent, len(ops))
+		for i := range ops {
+			events[i] = newNoteEvent(recorded[i], results[i].Note)
+		}
+		if err := publishNoteEvents(ctx, tx, events...); err != nil {
+			return err
+		}
+		return notesChanged(ctx, tx)
+	})
+
+	if failed < 0 {
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+
+	// Nothing was committed, so every operation other than the failing one
+	// is reported as aborted
+	for i := range results {
+		if i != failed {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+	return results, nil
+}
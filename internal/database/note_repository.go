@@ -3,11 +3,30 @@ package database
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/audit"
 	"github.com/moabdelazem/noter/internal/models"
 )
 
+// MaxTitleLength is the longest title the notes table can store
+const MaxTitleLength = 255
+
+// ValidateTitle checks a note title against the limits of the notes table
+func ValidateTitle(title string) []FieldError {
+	if title == "" {
+		return []FieldError{{Field: "title", Message: "is required"}}
+	}
+	if utf8.RuneCountInString(title) > MaxTitleLength {
+		return []FieldError{{Field: "title", Message: fmt.Sprintf("must be at most %d characters", MaxTitleLength)}}
+	}
+	return nil
+}
+
 // NoteRepository handles database operations for notes
 type NoteRepository struct {
 	db *DB
@@ -20,17 +39,26 @@ func NewNoteRepository(db *DB) *NoteRepository {
 	}
 }
 
-// CreateNote inserts a new note into the database
+// CreateNote inserts a new note into the database and records it in the audit log
 func (r *NoteRepository) CreateNote(ctx context.Context, note *models.Note) error {
 	query := `
 		INSERT INTO notes (id, title, created_at, updated_at)
 		VALUES ($1, $2, $3, $4)
 	`
-	_, err := r.db.Pool.Exec(ctx, query, note.ID, note.Title, note.CreatedAt, note.UpdatedAt)
-	if err != nil {
-		return fmt.Errorf("failed to create note: %w", err)
-	}
-	return nil
+	return r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query, note.ID, note.Title, note.CreatedAt, note.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create note: %w", mapError(err))
+		}
+		event, err := recordAuditEvent(ctx, tx, audit.ActionNoteCreate, note.ID, nil, note)
+		if err != nil {
+			return err
+		}
+		if err := publishNoteEvents(ctx, tx, newNoteEvent(event, note)); err != nil {
+			return err
+		}
+		return notesChanged(ctx, tx)
+	})
 }
 
 // GetAllNotes retrieves all notes from the database
@@ -40,7 +68,7 @@ func (r *NoteRepository) GetAllNotes(ctx context.Context) ([]*models.Note, error
 		FROM notes
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Pool.Query(ctx, query)
+	rows, err := r.db.conn(ctx).Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get notes: %w", err)
 	}
@@ -62,6 +90,26 @@ func (r *NoteRepository) GetAllNotes(ctx context.Context) ([]*models.Note, error
 	return notes, nil
 }
 
+// NotesVersion identifies the state of the notes collection without reading it
+type NotesVersion struct {
+	Version      int64
+	LastModified time.Time
+}
+
+// GetNotesVersion reads the version of the notes collection, which every
+// transaction changing the notes advances as it commits. Unlike the notes'
+// own timestamps, which are taken before their change commits, it never
+// stays the same across a change that became visible after it was read.
+func (r *NoteRepository) GetNotesVersion(ctx context.Context) (*NotesVersion, error) {
+	query := `SELECT version, updated_at FROM notes_version`
+	var version NotesVersion
+	err := r.db.conn(ctx).QueryRow(ctx, query).Scan(&version.Version, &version.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notes version: %w", err)
+	}
+	return &version, nil
+}
+
 // GetNoteByID retrieves a note by its ID
 func (r *NoteRepository) GetNoteByID(ctx context.Context, id uuid.UUID) (*models.Note, error) {
 	query := `
@@ -70,9 +118,211 @@ func (r *NoteRepository) GetNoteByID(ctx context.Context, id uuid.UUID) (*models
 		WHERE id = $1
 	`
 	var note models.Note
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(&note.ID, &note.Title, &note.CreatedAt, &note.UpdatedAt)
+	err := r.db.conn(ctx).QueryRow(ctx, query, id).Scan(&note.ID, &note.Title, &note.CreatedAt, &note.UpdatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get note by ID: %w", err)
+		return nil, fmt.Errorf("failed to get note by ID: %w", mapError(err))
 	}
 	return &note, nil
 }
+
+// NoteFilter narrows down and paginates the notes returned by ListNotes and StreamNotes
+type NoteFilter struct {
+	TitleContains string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	After         *NoteCursor
+	Limit         int
+}
+
+// NoteCursor identifies a position in the notes ordering, newest first
+type NoteCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// ListNotes retrieves the notes matching the filter, newest first
+func (r *NoteRepository) ListNotes(ctx context.Context, filter NoteFilter) ([]*models.Note, error) {
+	notes := []*models.Note{}
+	err := r.StreamNotes(ctx, filter, func(note *models.Note) error {
+		notes = append(notes, note)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// StreamNotes calls fn for every note matching the filter, newest first,
+// without loading the whole result set into memory
+func (r *NoteRepository) StreamNotes(ctx context.Context, filter NoteFilter, fn func(*models.Note) error) error {
+	var conditions []string
+	var args []any
+	addCondition := func(condition string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if filter.TitleContains != "" {
+		addCondition("strpos(lower(title), lower($%d)) > 0", filter.TitleContains)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		addCondition("created_at >= $%d", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		addCondition("created_at < $%d", filter.CreatedBefore)
+	}
+	if filter.After != nil {
+		addCondition("(created_at, id) < ($%d, $%d)", filter.After.CreatedAt, filter.After.ID)
+	}
+
+	query := `
+		SELECT id, title, created_at, updated_at
+		FROM notes
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	return r.streamNotes(ctx, fn, query, args...)
+}
+
+// GetNotesByIDs retrieves the notes with the given IDs in a single query.
+// IDs that do not exist are left out of the result.
+func (r *NoteRepository) GetNotesByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Note, error) {
+	query := `
+		SELECT id, title, created_at, updated_at
+		FROM notes
+		WHERE id = ANY($1)
+	`
+	return r.queryNotes(ctx, query, ids)
+}
+
+// UpdateNote applies fn to the stored note while holding a row lock, then
+// persists the result and records it in the audit log
+func (r *NoteRepository) UpdateNote(ctx context.Context, id uuid.UUID, fn func(*models.Note) error) (*models.Note, error) {
+	var updated models.Note
+	err := r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		query := `
+			SELECT id, title, created_at, updated_at
+			FROM notes
+			WHERE id = $1
+			FOR UPDATE
+		`
+		var before models.Note
+		err := tx.QueryRow(ctx, query, id).Scan(&before.ID, &before.Title, &before.CreatedAt, &before.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to get note by ID: %w", mapError(err))
+		}
+
+		updated = before
+		if err := fn(&updated); err != nil {
+			return err
+		}
+		updated.ID = before.ID
+		updated.CreatedAt = before.CreatedAt
+		updated.UpdatedAt = time.Now()
+
+		query = `
+			UPDATE notes
+			SET title = $2, updated_at = $3
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, updated.ID, updated.Title, updated.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to update note: %w", mapError(err))
+		}
+		event, err := recordAuditEvent(ctx, tx, audit.ActionNoteUpdate, id, &before, &updated)
+		if err != nil {
+			return err
+		}
+		if err := publishNoteEvents(ctx, tx, newNoteEvent(event, &updated)); err != nil {
+			return err
+		}
+		return notesChanged(ctx, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteNote removes a note from the database and records it in the audit log
+func (r *NoteRepository) DeleteNote(ctx context.Context, id uuid.UUID) error {
+	_, err := r.deleteNote(ctx, id)
+	return err
+}
+
+// deleteNote removes a note and returns it as it was before the delete
+func (r *NoteRepository) deleteNote(ctx context.Context, id uuid.UUID) (*models.Note, error) {
+	query := `
+		DELETE FROM notes
+		WHERE id = $1
+		RETURNING id, title, created_at, updated_at
+	`
+	var before models.Note
+	err := r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, id).Scan(&before.ID, &before.Title, &before.CreatedAt, &before.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to delete note: %w", mapError(err))
+		}
+		event, err := recordAuditEvent(ctx, tx, audit.ActionNoteDelete, id, &before, nil)
+		if err != nil {
+			return err
+		}
+		if err := publishNoteEvents(ctx, tx, newNoteEvent(event, &before)); err != nil {
+			return err
+		}
+		return notesChanged(ctx, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &before, nil
+}
+
+// queryNotes runs a query returning note rows and scans them
+func (r *NoteRepository) queryNotes(ctx context.Context, query string, args ...any) ([]*models.Note, error) {
+	notes := []*models.Note{}
+	err := r.streamNotes(ctx, func(note *models.Note) error {
+		notes = append(notes, note)
+		return nil
+	}, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// streamNotes runs a query returning note rows and calls fn for each as it is read
+func (r *NoteRepository) streamNotes(ctx context.Context, fn func(*models.Note) error, query string, args ...any) error {
+	rows, err := r.db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get notes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note models.Note
+		if err := rows.Scan(&note.ID, &note.Title, &note.CreatedAt, &note.UpdatedAt); err != nil {
+			return fmt.Errorf("failed to scan note: %w", err)
+		}
+		if err := fn(&note); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating notes: %w", err)
+	}
+
+	return nil
+}
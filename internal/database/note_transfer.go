@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// exportFetchSize is how many notes are fetched from the export cursor at a time
+const exportFetchSize = 1000
+
+// ImportResult counts what a bulk import did with the notes it was given
+type ImportResult struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// ExportNotes calls fn for every note, oldest first, reading them from a
+// server-side cursor a page at a time. The cursor reads a single snapshot,
+// so an export is consistent however long it runs.
+func (r *NoteRepository) ExportNotes(ctx context.Context, fn func(*models.Note) error) error {
+	return r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		query := `
+			DECLARE notes_export NO SCROLL CURSOR FOR
+			SELECT id, title, created_at, updated_at
+			FROM notes
+			ORDER BY created_at, id
+		`
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to open export cursor: %w", err)
+		}
+
+		for {
+			rows, err := tx.Query(ctx, fmt.Sprintf("FETCH %d FROM notes_export", exportFetchSize))
+			if err != nil {
+				return fmt.Errorf("failed to fetch notes: %w", err)
+			}
+
+			// The page is read before calling fn, as the transaction's
+			// connection is busy until the rows are closed
+			var page []*models.Note
+			for rows.Next() {
+				var note models.Note
+				if err := rows.Scan(&note.ID, &note.Title, &note.CreatedAt, &note.UpdatedAt); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan note: %w", err)
+				}
+				page = append(page, &note)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("error iterating notes: %w", err)
+			}
+
+			for _, note := range page {
+				if err := fn(note); err != nil {
+					return err
+				}
+			}
+			if len(page) < exportFetchSize {
+				return nil
+			}
+		}
+	})
+}
+
+// ImportNotes loads notes in bulk. next is called for each note until it
+// returns nil, while the notes are copied with COPY into a staging table;
+// an error from next aborts the import. The staged notes are then upserted
+// by ID in a single statement. Notes keep the timestamps they were imported
+// with, and an existing note is only overwritten by a copy edited after it,
+// so a note edited here since it was last imported keeps its edit. Each
+// note created or updated is recorded in the audit log, and an import that
+// changed any note is also audited as a whole and published as a single
+// imported event, after which subscribers must reload the notes.
+func (r *NoteRepository) ImportNotes(ctx context.Context, next func() (*models.Note, error)) (*ImportResult, error) {
+	var result ImportResult
+	err := r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		query := `
+			CREATE TEMPORARY TABLE notes_import (
+				id UUID NOT NULL,
+				title VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+			) ON COMMIT DROP
+		`
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to create import staging table: %w", err)
+		}
+
+		staged, err := tx.CopyFrom(ctx, pgx.Identifier{"notes_import"}, []string{"id", "title", "created_at", "updated_at"}, &noteCopySource{next: next})
+		if err != nil {
+			return fmt.Errorf("failed to copy notes: %w", err)
+		}
+
+		// When an ID appears more than once, its newest copy wins. Every
+		// note created or updated is audited like a single write, with a
+		// diff of the fields it changed.
+		query = fmt.Sprintf(`
+			WITH incoming AS (
+				SELECT DISTINCT ON (id) id, title, created_at, updated_at
+				FROM notes_import
+				ORDER BY id, updated_at DESC
+			), previous AS (
+				SELECT notes.id, notes.title, notes.updated_at
+				FROM notes
+				JOIN incoming ON incoming.id = notes.id
+			), upserted AS (
+				INSERT INTO notes (id, title, created_at, updated_at)
+				SELECT id, title, created_at, updated_at FROM incoming
+				ON CONFLICT (id) DO UPDATE
+				SET title = EXCLUDED.title, updated_at = EXCLUDED.updated_at
+				WHERE notes.updated_at < EXCLUDED.updated_at
+				RETURNING notes.id, notes.title, notes.created_at, notes.updated_at, (xmax = 0) AS created
+			), audited AS (
+				INSERT INTO audit_events (action, note_id, request_id, ip, diff)
+				SELECT
+					CASE WHEN upserted.created THEN $1 ELSE $2 END,
+					upserted.id, $3, $4,
+					CASE WHEN upserted.created THEN jsonb_build_object(
+						'id', jsonb_build_object('new', upserted.id),
+						'title', jsonb_build_object('new', upserted.title),
+						'created_at', jsonb_build_object('new', %s),
+						'updated_at', jsonb_build_object('new', %s)
+					) ELSE jsonb_build_object(
+						'updated_at', jsonb_build_object('old', %s, 'new', %s)
+					) || CASE WHEN upserted.title <> previous.title THEN jsonb_build_object(
+						'title', jsonb_build_object('old', previous.title, 'new', upserted.title)
+					) ELSE '{}' END END
+				FROM upserted
+				LEFT JOIN previous ON previous.id = upserted.id
+				ORDER BY upserted.created_at, upserted.id
+			)
+			SELECT COUNT(*) FILTER (WHERE created), COUNT(*) FILTER (WHERE NOT created)
+			FROM upserted
+		`, jsonTime("upserted.created_at"), jsonTime("upserted.updated_at"), jsonTime("previous.updated_at"), jsonTime("upserted.updated_at"))
+		info := audit.FromContext(ctx)
+		err = tx.QueryRow(ctx, query, audit.ActionNoteCreate, audit.ActionNoteUpdate, info.RequestID, info.IP).Scan(&result.Created, &result.Updated)
+		if err != nil {
+			return fmt.Errorf("failed to upsert imported notes: %w", mapError(err))
+		}
+		// Older copies of existing notes and repeated IDs change nothing
+		result.Unchanged = int(staged) - result.Created - result.Updated
+		if result.Created+result.Updated == 0 {
+			return nil
+		}
+
+		// The import as a whole is audited too, and its event is the one published
+		diff, err := json.Marshal(map[string]audit.Change{
+			"created": {New: result.Created},
+			"updated": {New: result.Updated},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode import summary: %w", err)
+		}
+		event := &models.AuditEvent{
+			Action:    audit.ActionNoteImport,
+			RequestID: info.RequestID,
+			IP:        info.IP,
+			Diff:      diff,
+		}
+		if err := insertAuditEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		imported := newNoteEvent(event, nil)
+		imported.Import = &result
+		if err := publishNoteEvents(ctx, tx, imported); err != nil {
+			return err
+		}
+		return notesChanged(ctx, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// jsonTime formats a timestamp column in SQL the way encoding/json formats
+// a UTC time.Time, so audit diffs written in SQL read like those written in Go
+func jsonTime(column string) string {
+	return fmt.Sprintf(`rtrim(rtrim(to_char(%s AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US'), '0'), '.') || 'Z'`, column)
+}
+
+// noteCopySource feeds the notes returned by next to COPY
+type noteCopySource struct {
+	next func() (*models.Note, error)
+	note *models.Note
+	err  error
+}
+
+// Next advances to the next note
+func (s *noteCopySource) Next() bool {
+	s.note, s.err = s.next()
+	return s.note != nil && s.err == nil
+}
+
+// Values returns the columns of the current note
+func (s *noteCopySource) Values() ([]any, error) {
+	return []any{s.note.ID, s.note.Title, s.note.CreatedAt, s.note.UpdatedAt}, nil
+}
+
+// Err returns the error that stopped the copy, if any
+func (s *noteCopySource) Err() error {
+	return s.err
+}
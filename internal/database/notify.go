@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// NoteEventsChannel is the channel note changes are published on
+const NoteEventsChannel = "note_events"
+
+// noteEventTypes maps audit actions to the type of the change event published for them
+var noteEventTypes = map[string]string{
+	audit.ActionNoteCreate: "created",
+	audit.ActionNoteUpdate: "updated",
+	audit.ActionNoteDelete: "deleted",
+	audit.ActionNoteImport: "imported",
+}
+
+// noteEvent is a note change as it is published on NoteEventsChannel and
+// recorded in the outbox. Both payloads are encoded here, so they always
+// agree on their format. A bulk import is published as a single event
+// without a note, carrying what the import did instead.
+type noteEvent struct {
+	ID         int64         `json:"id"`
+	Type       string        `json:"type"`
+	NoteID     *uuid.UUID    `json:"note_id,omitempty"`
+	Note       any           `json:"note,omitempty"`
+	Import     *ImportResult `json:"import,omitempty"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// newNoteEvent describes the change recorded by an audit event. The event
+// carries the note as it is after the change, or as it was before it was
+// deleted.
+func newNoteEvent(event *models.AuditEvent, note any) *noteEvent {
+	return &noteEvent{
+		ID:         event.ID,
+		Type:       noteEventTypes[event.Action],
+		NoteID:     event.NoteID,
+		Note:       note,
+		OccurredAt: event.CreatedAt.UTC(),
+	}
+}
+
+// outboxType is the type the event is recorded in the outbox with
+func (e *noteEvent) outboxType() string {
+	return "note." + e.Type
+}
+
+// encode returns the payload of the event with the given type
+func (e *noteEvent) encode(eventType string) ([]byte, error) {
+	event := *e
+	event.Type = eventType
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode note event: %w", err)
+	}
+	return payload, nil
+}
+
+// publishNoteEvents publishes note changes on NoteEventsChannel and records
+// them in the outbox, within the transaction of the changes themselves.
+// Notifications are only delivered, and outbox messages only become
+// visible, once the transaction commits.
+func publishNoteEvents(ctx context.Context, tx pgx.Tx, events ...*noteEvent) error {
+	batch := &pgx.Batch{}
+	for _, event := range events {
+		if err := queueOutboxMessage(batch, event); err != nil {
+			return err
+		}
+		payload, err := event.encode(event.Type)
+		if err != nil {
+			return err
+		}
+		batch.Queue(`SELECT pg_notify($1, $2)`, NoteEventsChannel, string(payload))
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to publish note events: %w", err)
+	}
+	return nil
+}
+
+// Listen takes a dedicated connection out of the pool, LISTENs on channel
+// and calls fn with the payload of every notification until ctx is done or
+// the connection fails. It always returns a non-nil error.
+func (db *DB) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// The connection is hijacked so the pool never hands it to a query while
+	// it is listening, and can open another in its place
+	listener := conn.Hijack()
+	defer listener.Close(context.Background())
+
+	if _, err := listener.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	for {
+		notification, err := listener.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+		fn(notification.Payload)
+	}
+}
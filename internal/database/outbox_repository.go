@@ -0,0 +1,172 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// OutboxRepository handles database operations for the outbox
+type OutboxRepository struct {
+	db *DB
+}
+
+// NewOutboxRepository creates a new outbox repository
+func NewOutboxRepository(db *DB) *OutboxRepository {
+	return &OutboxRepository{
+		db: db,
+	}
+}
+
+// claimLease is how long claimed messages are held for their dispatcher.
+// Messages still claimed when it runs out, because their dispatcher stopped
+// part way, are claimed again and delivered at least once more.
+const claimLease = 5 * time.Minute
+
+// queueOutboxMessage adds the write recording a note change in the outbox
+// to a batch sent within the transaction of the change. Events about the
+// whole collection, like bulk imports, are ordered under the nil note ID.
+func queueOutboxMessage(batch *pgx.Batch, event *noteEvent) error {
+	payload, err := event.encode(event.outboxType())
+	if err != nil {
+		return err
+	}
+	var noteID uuid.UUID
+	if event.NoteID != nil {
+		noteID = *event.NoteID
+	}
+	query := `
+		INSERT INTO outbox (event_id, note_id, event_type, payload)
+		VALUES ($1, $2, $3, $4)
+	`
+	batch.Queue(query, event.ID, noteID, event.outboxType(), payload)
+	return nil
+}
+
+// Dispatch claims up to limit due outbox messages and hands each to
+// deliver. Delivered messages are marked as dispatched; failed ones are
+// retried after backoff(attempts). A note is only claimed when its oldest
+// pending message is due, and then its pending messages are claimed
+// together, oldest first, so a note's messages are delivered in order and a
+// failing one holds back the ones behind it. The claim is committed before
+// delivering, so no transaction stays open while the sinks run. Order is
+// kept up to the sinks; the webhook sink queues deliveries that are then
+// sent independently, so webhook receivers order events by their ID.
+// It returns how many messages were claimed.
+func (r *OutboxRepository) Dispatch(ctx context.Context, limit int, deliver func(ctx context.Context, msg *models.OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error) {
+	messages, err := r.claim(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var released []int64
+	failed := make(map[uuid.UUID]bool)
+	for _, msg := range messages {
+		if failed[msg.NoteID] {
+			released = append(released, msg.ID)
+			continue
+		}
+
+		if err := deliver(ctx, msg); err != nil {
+			failed[msg.NoteID] = true
+			query := `
+				UPDATE outbox
+				SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + $3::interval, claimed_until = NULL
+				WHERE id = $1
+			`
+			if _, err := r.db.Pool.Exec(ctx, query, msg.ID, err.Error(), backoff(msg.Attempts+1)); err != nil {
+				return len(messages), fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			continue
+		}
+
+		query := `UPDATE outbox SET attempts = attempts + 1, last_error = '', dispatched_at = NOW(), claimed_until = NULL WHERE id = $1`
+		if _, err := r.db.Pool.Exec(ctx, query, msg.ID); err != nil {
+			return len(messages), fmt.Errorf("failed to mark outbox message dispatched: %w", err)
+		}
+	}
+
+	// The messages behind a failed one wait for it to be retried
+	if len(released) > 0 {
+		if _, err := r.db.Pool.Exec(ctx, `UPDATE outbox SET claimed_until = NULL WHERE id = ANY($1)`, released); err != nil {
+			return len(messages), fmt.Errorf("failed to release outbox messages: %w", err)
+		}
+	}
+	return len(messages), nil
+}
+
+// claim leases up to limit pending messages, oldest first, from the notes
+// whose oldest pending message, their head, is due and not claimed. Heads
+// are locked with SKIP LOCKED while the claim is taken, so a concurrent
+// dispatcher skips a note being claimed instead of waiting for it, and it
+// cannot take a later message of that note for a head while an earlier one
+// is still pending.
+func (r *OutboxRepository) claim(ctx context.Context, limit int) ([]*models.OutboxMessage, error) {
+	query := `
+		WITH heads AS (
+			SELECT id, note_id
+			FROM outbox
+			WHERE dispatched_at IS NULL
+				AND next_attempt_at <= NOW()
+				AND (claimed_until IS NULL OR claimed_until <= NOW())
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox earlier
+					WHERE earlier.note_id = outbox.note_id
+						AND earlier.dispatched_at IS NULL
+						AND earlier.id < outbox.id
+				)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), claimable AS (
+			SELECT outbox.id
+			FROM outbox
+			JOIN heads ON heads.note_id = outbox.note_id
+			WHERE outbox.dispatched_at IS NULL
+			ORDER BY outbox.id
+			LIMIT $1
+		)
+		UPDATE outbox
+		SET claimed_until = NOW() + $2::interval
+		FROM claimable
+		WHERE outbox.id = claimable.id
+		RETURNING outbox.id, outbox.event_id, outbox.note_id, outbox.event_type, outbox.payload, outbox.attempts, outbox.created_at
+	`
+	rows, err := r.db.Pool.Query(ctx, query, limit, claimLease)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var m models.OutboxMessage
+		if err := rows.Scan(&m.ID, &m.EventID, &m.NoteID, &m.EventType, &m.Payload, &m.Attempts, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		messages = append(messages, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox messages: %w", err)
+	}
+
+	// RETURNING does not keep the order of the claimed rows
+	slices.SortFunc(messages, func(a, b *models.OutboxMessage) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return messages, nil
+}
+
+// PurgeDispatched deletes the messages dispatched before the given time
+func (r *OutboxRepository) PurgeDispatched(ctx context.Context, before time.Time) error {
+	if _, err := r.db.Pool.Exec(ctx, `DELETE FROM outbox WHERE dispatched_at < $1`, before); err != nil {
+		return fmt.Errorf("failed to purge outbox: %w", err)
+	}
+	return nil
+}
@@ -5,15 +5,58 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // TxFn is a function that executes within a transaction
 type TxFn func(pgx.Tx) error
 
-// WithTransaction executes the given function within a transaction
+// txKey is the context key of a transaction the repositories join
+type txKey struct{}
+
+// txState is a transaction the repositories join, carried by a context
+type txState struct {
+	tx pgx.Tx
+	// notesChanged is set when a change to the notes is made in the
+	// transaction, so the version of the collection is advanced once,
+	// right before it commits
+	notesChanged bool
+}
+
+// withTx returns a context carrying tx for the repositories to join
+func withTx(ctx context.Context, tx pgx.Tx) (context.Context, *txState) {
+	state := &txState{tx: tx}
+	return context.WithValue(ctx, txKey{}, state), state
+}
+
+// querier runs statements on the pool or within a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// conn returns the transaction carried by ctx, so reads see the writes made
+// before them in it, or the pool when there is none
+func (db *DB) conn(ctx context.Context) querier {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return db.Pool
+}
+
+// WithTransaction executes the given function within a transaction. When
+// ctx carries a transaction, the function runs in a savepoint of it and its
+// changes are committed along with that transaction.
 func (db *DB) WithTransaction(ctx context.Context, fn TxFn) error {
 	// Begin transaction
-	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{})
+	var tx pgx.Tx
+	var err error
+	if outer, ok := ctx.Value(txKey{}).(*txState); ok {
+		tx, err = outer.tx.Begin(ctx)
+	} else {
+		tx, err = db.Pool.BeginTx(ctx, pgx.TxOptions{})
+	}
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -34,3 +77,33 @@ func (db *DB) WithTransaction(ctx context.Context, fn TxFn) error {
 
 	return nil
 }
+
+// bumpNotesVersionQuery advances the version of the notes collection. The
+// row lock it takes is held until the transaction commits, so versions are
+// handed out in commit order: once a version is visible, every change with
+// a lower one is too. Its time never goes backwards, whatever the clock does.
+const bumpNotesVersionQuery = `
+	UPDATE notes_version
+	SET version = version + 1, updated_at = GREATEST(updated_at, clock_timestamp())
+`
+
+// notesChanged advances the version of the notes collection within tx, the
+// transaction of a change to the notes. It is called last, right before
+// the commit, to keep the version's lock short. When ctx carries an outer
+// transaction, the version is advanced by that transaction instead, as it
+// commits the change.
+func notesChanged(ctx context.Context, tx pgx.Tx) error {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.notesChanged = true
+		return nil
+	}
+	return bumpNotesVersion(ctx, tx)
+}
+
+// bumpNotesVersion advances the version of the notes collection within tx
+func bumpNotesVersion(ctx context.Context, tx pgx.Tx) error {
+	if _, err := tx.Exec(ctx, bumpNotesVersionQuery); err != nil {
+		return fmt.Errorf("failed to advance notes version: %w", err)
+	}
+	return nil
+}
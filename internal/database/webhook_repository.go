@@ -0,0 +1,331 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// WebhookUpdate holds the fields of a webhook to change. Nil fields are left as they are.
+type WebhookUpdate struct {
+	URL        *string
+	EventTypes []string
+	Active     *bool
+}
+
+// ClaimedDelivery is a due webhook delivery along with where to send it
+type ClaimedDelivery struct {
+	Delivery *models.WebhookDelivery
+	URL      string
+	Secret   string
+}
+
+// DeliveryAttempt is the outcome of a single attempt to deliver a webhook
+type DeliveryAttempt struct {
+	Succeeded  bool
+	StatusCode int
+	Error      string
+	// RetryAt schedules another attempt after a failure; nil gives up on the delivery
+	RetryAt *time.Time
+	// DisableAfter deactivates the webhook once it has failed this many times
+	// in a row; zero never deactivates it
+	DisableAfter int
+}
+
+// WebhookRepository handles database operations for webhooks and their deliveries
+type WebhookRepository struct {
+	db *DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *DB) *WebhookRepository {
+	return &WebhookRepository{
+		db: db,
+	}
+}
+
+// webhookColumns are the columns scanned by scanWebhook
+const webhookColumns = `id, url, event_types, secret, active, consecutive_failures, disabled_at, created_at, updated_at`
+
+// deliveryColumns are the columns scanned by scanDelivery
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at`
+
+// CreateWebhook inserts a new webhook
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	query := `
+		INSERT INTO webhooks (id, url, event_types, secret, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.conn(ctx).Exec(ctx, query, webhook.ID, webhook.URL, webhook.EventTypes, webhook.Secret, webhook.Active, webhook.CreatedAt, webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", mapError(err))
+	}
+	return nil
+}
+
+// ListWebhooks retrieves every webhook, newest first
+func (r *WebhookRepository) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY created_at DESC`
+	rows, err := r.db.conn(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []*models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook retrieves a webhook by its ID
+func (r *WebhookRepository) GetWebhook(ctx context.Context, id uuid.UUID) (*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+	webhook, err := scanWebhook(r.db.conn(ctx).QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", mapError(err))
+	}
+	return webhook, nil
+}
+
+// UpdateWebhook changes the fields of a webhook set in update. Reactivating
+// a webhook clears its failure count.
+func (r *WebhookRepository) UpdateWebhook(ctx context.Context, id uuid.UUID, update WebhookUpdate) (*models.Webhook, error) {
+	query := `
+		UPDATE webhooks
+		SET url = COALESCE($2, url),
+			event_types = COALESCE($3, event_types),
+			active = COALESCE($4, active),
+			consecutive_failures = CASE WHEN $4 THEN 0 ELSE consecutive_failures END,
+			disabled_at = CASE WHEN $4 THEN NULL WHEN NOT $4 THEN COALESCE(disabled_at, NOW()) ELSE disabled_at END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + webhookColumns
+	webhook, err := scanWebhook(r.db.conn(ctx).QueryRow(ctx, query, id, update.URL, update.EventTypes, update.Active))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", mapError(err))
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries
+func (r *WebhookRepository) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.conn(ctx).Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", mapError(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete webhook: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// EnqueueDeliveries queues the delivery of a note event to every active
+// webhook subscribed to its type. Webhooks that already have a delivery of
+// the event are skipped, so enqueueing the same event again is harmless.
+func (r *WebhookRepository) EnqueueDeliveries(ctx context.Context, eventID int64, eventType string, payload json.RawMessage) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, next_attempt_at)
+		SELECT webhooks.id, $1::bigint, $2::text, $3::jsonb, NOW()
+		FROM webhooks
+		WHERE webhooks.active
+			AND $2::text = ANY(webhooks.event_types)
+			AND NOT EXISTS (
+				SELECT 1 FROM webhook_deliveries
+				WHERE webhook_deliveries.webhook_id = webhooks.id AND webhook_deliveries.event_id = $1
+			)
+	`
+	if _, err := r.db.conn(ctx).Exec(ctx, query, eventID, eventType, payload); err != nil {
+		return fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries retrieves the latest deliveries of a webhook, newest first
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]*models.WebhookDelivery, error) {
+	if _, err := r.GetWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+	rows, err := r.db.conn(ctx).Query(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver queues a new delivery of the event sent by an earlier one, so
+// the original stays in the log untouched
+func (r *WebhookRepository) Redeliver(ctx context.Context, webhookID uuid.UUID, deliveryID int64) (*models.WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, next_attempt_at)
+		SELECT webhook_id, event_id, event_type, payload, NOW()
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING ` + deliveryColumns
+	delivery, err := scanDelivery(r.db.conn(ctx).QueryRow(ctx, query, deliveryID, webhookID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeliver webhook delivery: %w", mapError(err))
+	}
+	return delivery, nil
+}
+
+// ClaimDueDeliveries claims up to limit pending deliveries that are due, to
+// active webhooks. Claimed deliveries are leased: they are not handed out
+// again until lease has passed, so a worker that dies mid-delivery does not
+// lose them. Concurrent workers skip each other's rows.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*ClaimedDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT webhook_deliveries.id
+			FROM webhook_deliveries
+			JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+			WHERE webhook_deliveries.status = 'pending'
+				AND webhook_deliveries.next_attempt_at <= NOW()
+				AND webhooks.active
+			ORDER BY webhook_deliveries.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF webhook_deliveries SKIP LOCKED
+		)
+		UPDATE webhook_deliveries
+		SET next_attempt_at = NOW() + $2::interval
+		FROM due, webhooks
+		WHERE webhook_deliveries.id = due.id AND webhooks.id = webhook_deliveries.webhook_id
+		RETURNING webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.event_id,
+			webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.status,
+			webhook_deliveries.attempts, webhook_deliveries.next_attempt_at, webhook_deliveries.last_status_code,
+			webhook_deliveries.last_error, webhook_deliveries.created_at, webhook_deliveries.delivered_at,
+			webhooks.url, webhooks.secret
+	`
+	rows, err := r.db.conn(ctx).Query(ctx, query, limit, lease)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []*ClaimedDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var c ClaimedDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt,
+			&c.URL, &c.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		c.Delivery = &d
+		claimed = append(claimed, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// RecordAttempt stores the outcome of a delivery attempt and keeps the
+// webhook's count of failures in a row up to date
+func (r *WebhookRepository) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt DeliveryAttempt) error {
+	status := models.DeliveryPending
+	switch {
+	case attempt.Succeeded:
+		status = models.DeliverySucceeded
+	case attempt.RetryAt == nil:
+		status = models.DeliveryFailed
+	}
+	var statusCode *int
+	if attempt.StatusCode != 0 {
+		statusCode = &attempt.StatusCode
+	}
+
+	return r.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		query := `
+			UPDATE webhook_deliveries
+			SET status = $2,
+				attempts = attempts + 1,
+				next_attempt_at = $3,
+				last_status_code = $4,
+				last_error = $5,
+				delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() END
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, delivery.ID, status, attempt.RetryAt, statusCode, attempt.Error); err != nil {
+			return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+		}
+
+		// The right-hand sides see the row as it was before the update
+		query = `
+			UPDATE webhooks
+			SET consecutive_failures = CASE WHEN $2 THEN 0 ELSE consecutive_failures + 1 END,
+				active = active AND ($2 OR $3 = 0 OR consecutive_failures + 1 < $3),
+				disabled_at = CASE
+					WHEN active AND NOT $2 AND $3 > 0 AND consecutive_failures + 1 >= $3 THEN NOW()
+					ELSE disabled_at
+				END
+			WHERE id = $1
+		`
+		if _, err := tx.Exec(ctx, query, delivery.WebhookID, attempt.Succeeded, attempt.DisableAfter); err != nil {
+			return fmt.Errorf("failed to update webhook failures: %w", err)
+		}
+		return nil
+	})
+}
+
+// scanWebhook scans a webhook row
+func scanWebhook(row pgx.Row) (*models.Webhook, error) {
+	var w models.Webhook
+	err := row.Scan(&w.ID, &w.URL, &w.EventTypes, &w.Secret, &w.Active, &w.ConsecutiveFailures, &w.DisabledAt, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// scanDelivery scans a webhook delivery row
+func scanDelivery(row pgx.Row) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
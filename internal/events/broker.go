@@ -0,0 +1,191 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is disconnected, after which it can resume from the replay buffer
+const subscriberBuffer = 64
+
+// Event is a single note change
+type Event struct {
+	ID   string
+	Type string
+	Data json.RawMessage
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	// Replay holds the buffered events the subscriber missed
+	Replay []Event
+	events chan Event
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscriber falls too far behind, the stream is interrupted or the broker
+// shuts down.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Broker fans note changes out to subscribers and keeps the latest of them
+// in a bounded buffer so subscribers can resume after reconnecting
+type Broker struct {
+	mu          sync.Mutex
+	buffer      []Event
+	size        int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// NewBroker creates a broker replaying up to size events
+func NewBroker(size int) *Broker {
+	return &Broker{
+		size:        size,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber. When lastEventID is set, the events
+// published after it are replayed; resumed is false when that event is no
+// longer buffered, in which case the subscriber has missed events and must
+// reload its state.
+func (b *Broker) Subscribe(lastEventID string) (sub *Subscription, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{events: make(chan Event, subscriberBuffer)}
+	resumed = true
+	if lastEventID != "" {
+		resumed = false
+		for i := len(b.buffer) - 1; i >= 0; i-- {
+			if b.buffer[i].ID == lastEventID {
+				sub.Replay = append([]Event(nil), b.buffer[i+1:]...)
+				resumed = true
+				break
+			}
+		}
+	}
+
+	if b.closed {
+		close(sub.events)
+		return sub, resumed
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, resumed
+}
+
+// Unsubscribe removes a subscriber
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Publish buffers an event and delivers it to every subscriber. Subscribers
+// that have fallen too far behind are disconnected instead of blocking the
+// others.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buffer = append(b.buffer, event)
+	if len(b.buffer) > b.size {
+		b.buffer = b.buffer[len(b.buffer)-b.size:]
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Reset drops the buffered events and disconnects every subscriber. It is
+// used when events may have been missed, so nobody resumes across the gap.
+func (b *Broker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buffer = nil
+	b.disconnectAll()
+}
+
+// Close disconnects every subscriber and rejects new ones
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.disconnectAll()
+}
+
+// disconnectAll closes every subscription. The caller must hold b.mu.
+func (b *Broker) disconnectAll() {
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// notification is the payload published for every note change
+type notification struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+// Run publishes the notifications received by listen until ctx is done,
+// listening again with backoff whenever the connection fails. Notifications
+// sent while the broker was not listening are lost, so the broker is reset
+// after every failure.
+func (b *Broker) Run(ctx context.Context, listen func(ctx context.Context, fn func(payload string)) error) {
+	defer b.Close()
+
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := listen(ctx, b.handleNotification)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("note event listener stopped, retrying in %s: %v", backoff, err)
+		b.Reset()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// handleNotification publishes the event carried by a notification payload
+func (b *Broker) handleNotification(payload string) {
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		log.Printf("ignoring malformed note event: %v", err)
+		return
+	}
+	b.Publish(Event{
+		ID:   strconv.FormatInt(n.ID, 10),
+		Type: n.Type,
+		Data: json.RawMessage(payload),
+	})
+}
@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Handler serves GraphQL queries and mutations over notes
+type Handler struct {
+	schema graphql.Schema
+	notes  NoteStore
+	audit  AuditStore
+}
+
+// Request represents the body of a GraphQL request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// NewHandler creates a new GraphQL handler
+func NewHandler(notes NoteStore, audit AuditStore) *Handler {
+	schema, err := newSchema(notes)
+	if err != nil {
+		// The schema is static, so this can only be a programming error
+		panic(err)
+	}
+	return &Handler{
+		schema: schema,
+		notes:  notes,
+		audit:  audit,
+	}
+}
+
+// ServeHTTP handles a single GraphQL request
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query == "" {
+		writeResult(w, http.StatusBadRequest, errorResult("Invalid request body"))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		writeResult(w, http.StatusBadRequest, &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.FormatError(err)}})
+		return
+	}
+	if err := checkLimits(doc, req.Variables); err != nil {
+		writeResult(w, http.StatusBadRequest, errorResult(err.Error()))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), loadersKey{}, newLoaders(h.notes, h.audit))
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+
+	writeResult(w, http.StatusOK, result)
+}
+
+// errorResult builds a result holding a single error message
+func errorResult(message string) *graphql.Result {
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: message}}}
+}
+
+// writeResult sends a GraphQL result as JSON
+func writeResult(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	// maxQueryDepth is the deepest field nesting a query may use
+	maxQueryDepth = 6
+	// maxQueryComplexity is the highest estimated number of resolved fields a query may cost
+	maxQueryComplexity = 2000
+)
+
+// checkLimits rejects queries that are nested too deeply or would resolve
+// too many fields, before they reach the database
+func checkLimits(doc *ast.Document, variables map[string]interface{}) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	l := limiter{fragments: fragments, variables: variables}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		depth, complexity := l.measure(op.SelectionSet, map[string]bool{})
+		if depth > maxQueryDepth {
+			return fmt.Errorf("query depth %d exceeds the limit of %d", depth, maxQueryDepth)
+		}
+		if complexity > maxQueryComplexity {
+			return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, maxQueryComplexity)
+		}
+	}
+	return nil
+}
+
+// limiter measures the depth and complexity of selection sets
+type limiter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// measure returns the depth and estimated complexity of a selection set.
+// Fragments are inlined; visiting guards against fragment cycles.
+func (l limiter) measure(set *ast.SelectionSet, visiting map[string]bool) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	maxDepth, total := 0, 0
+	for _, selection := range set.Selections {
+		var depth, complexity int
+		switch s := selection.(type) {
+		case *ast.Field:
+			// Introspection is served from the schema and never touches the database
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			childDepth, childComplexity := l.measure(s.SelectionSet, visiting)
+			depth = childDepth + 1
+			complexity = 1 + l.multiplier(s)*childComplexity
+		case *ast.InlineFragment:
+			depth, complexity = l.measure(s.SelectionSet, visiting)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			fragment, ok := l.fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			depth, complexity = l.measure(fragment.SelectionSet, visiting)
+			delete(visiting, name)
+		}
+		maxDepth = max(maxDepth, depth)
+		total += complexity
+	}
+	return maxDepth, total
+}
+
+// multiplier estimates how many times the children of a list field are
+// resolved. Page sizes are clamped to the range the resolvers accept, so an
+// invalid first cannot lower the estimate; the resolver rejects it anyway.
+func (l limiter) multiplier(field *ast.Field) int {
+	switch field.Name.Value {
+	case "notes", "auditEvents":
+		for _, arg := range field.Arguments {
+			if arg.Name.Value == "first" {
+				return min(max(l.intValue(arg.Value, maxPageSize), 1), maxPageSize)
+			}
+		}
+		return defaultPageSize
+	default:
+		return 1
+	}
+}
+
+// intValue reads an integer literal or variable, falling back when it is unknown
+func (l limiter) intValue(value ast.Value, fallback int) int {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		if n, err := strconv.Atoi(v.Value); err == nil {
+			return n
+		}
+	case *ast.Variable:
+		switch n := l.variables[v.Name.Value].(type) {
+		case float64:
+			return int(n)
+		case int:
+			return n
+		}
+	}
+	return fallback
+}
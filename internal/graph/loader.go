@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"context"
+	"sync"
+)
+
+// loader batches the keys requested while a level of the query is resolved
+// and fetches them with a single call once the first result is needed
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	results map[K]V
+	errs    map[K]error
+}
+
+// newLoader creates a loader around a batch fetch function
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		queued:  make(map[K]bool),
+		results: make(map[K]V),
+		errs:    make(map[K]error),
+	}
+}
+
+// Load queues key for the next batch and returns a thunk that resolves to its
+// value. Keys missing from the fetch result resolve to the zero value.
+func (l *loader[K, V]) Load(ctx context.Context, key K) func() (interface{}, error) {
+	l.mu.Lock()
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			keys := l.pending
+			l.pending = nil
+			values, err := l.fetch(ctx, keys)
+			for _, k := range keys {
+				if err != nil {
+					l.errs[k] = err
+					continue
+				}
+				l.results[k] = values[k]
+			}
+		}
+
+		if err := l.errs[key]; err != nil {
+			return nil, err
+		}
+		return l.results[key], nil
+	}
+}
+
+// Prime stores a value that is already known so it is never fetched
+func (l *loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.results[key] = value
+	}
+}
@@ -0,0 +1,474 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errNoteNotFound = errors.New("note not found")
+
+// NoteStore is the subset of database.NoteRepository used by the schema
+type NoteStore interface {
+	CreateNote(ctx context.Context, note *models.Note) error
+	ListNotes(ctx context.Context, filter database.NoteFilter) ([]*models.Note, error)
+	GetNotesByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Note, error)
+	UpdateNote(ctx context.Context, id uuid.UUID, fn func(*models.Note) error) (*models.Note, error)
+	DeleteNote(ctx context.Context, id uuid.UUID) error
+}
+
+// AuditStore is the subset of database.AuditRepository used by the schema
+type AuditStore interface {
+	EventsByNoteIDs(ctx context.Context, ids []uuid.UUID, limit int) (map[uuid.UUID][]*models.AuditEvent, error)
+}
+
+// auditEventsKey identifies the audit events loaded for a note, which are
+// capped by the first argument of the field requesting them
+type auditEventsKey struct {
+	noteID uuid.UUID
+	first  int
+}
+
+// loaders holds the per-request batch loaders used by field resolvers
+type loaders struct {
+	notes       *loader[uuid.UUID, *models.Note]
+	auditEvents *loader[auditEventsKey, []*models.AuditEvent]
+}
+
+type loadersKey struct{}
+
+// newLoaders creates a fresh set of loaders for a single request
+func newLoaders(notes NoteStore, audit AuditStore) *loaders {
+	return &loaders{
+		notes: newLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Note, error) {
+			found, err := notes.GetNotesByIDs(ctx, ids)
+			if err != nil {
+				return nil, database.Internal(ctx, err)
+			}
+			byID := make(map[uuid.UUID]*models.Note, len(found))
+			for _, note := range found {
+				byID[note.ID] = note
+			}
+			return byID, nil
+		}),
+		auditEvents: newLoader(func(ctx context.Context, keys []auditEventsKey) (map[auditEventsKey][]*models.AuditEvent, error) {
+			// Fields asking for different page sizes are fetched separately
+			idsByFirst := make(map[int][]uuid.UUID)
+			for _, key := range keys {
+				idsByFirst[key.first] = append(idsByFirst[key.first], key.noteID)
+			}
+			byKey := make(map[auditEventsKey][]*models.AuditEvent, len(keys))
+			for first, ids := range idsByFirst {
+				events, err := audit.EventsByNoteIDs(ctx, ids, first)
+				if err != nil {
+					return nil, database.Internal(ctx, err)
+				}
+				for id, noteEvents := range events {
+					byKey[auditEventsKey{noteID: id, first: first}] = noteEvents
+				}
+			}
+			return byKey, nil
+		}),
+	}
+}
+
+// loadersFromContext returns the loaders attached to the request context
+func loadersFromContext(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// newSchema builds the GraphQL schema over notes and their audit history
+func newSchema(notes NoteStore) (graphql.Schema, error) {
+	var noteType *graphql.Object
+
+	auditEventType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "AuditEvent",
+		Description: "A recorded change to a note",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.ID),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return strconv.FormatInt(p.Source.(*models.AuditEvent).ID, 10), nil
+					},
+				},
+				"action": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*models.AuditEvent).Action, nil
+					},
+				},
+				"requestId": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*models.AuditEvent).RequestID, nil
+					},
+				},
+				"ip": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*models.AuditEvent).IP, nil
+					},
+				},
+				"diff": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "The changed fields, encoded as a JSON object",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return string(p.Source.(*models.AuditEvent).Diff), nil
+					},
+				},
+				"createdAt": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.DateTime),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*models.AuditEvent).CreatedAt, nil
+					},
+				},
+				"note": &graphql.Field{
+					Type:        noteType,
+					Description: "The note the event belongs to, or null if it has since been deleted",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						event := p.Source.(*models.AuditEvent)
+						if event.NoteID == nil {
+							return nil, nil
+						}
+						return loadersFromContext(p.Context).notes.Load(p.Context, *event.NoteID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	noteType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Note",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*models.Note).ID.String(), nil
+				},
+			},
+			"title": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*models.Note).Title, nil
+				},
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*models.Note).CreatedAt, nil
+				},
+			},
+			"updatedAt": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*models.Note).UpdatedAt, nil
+				},
+			},
+			"auditEvents": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(auditEventType))),
+				Description: "The note's audit history, newest first",
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: defaultPageSize,
+						Description:  fmt.Sprintf("Number of events, at most %d", maxPageSize),
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					first, err := pageSize(p.Args["first"])
+					if err != nil {
+						return nil, err
+					}
+					note := p.Source.(*models.Note)
+					key := auditEventsKey{noteID: note.ID, first: first}
+					return loadersFromContext(p.Context).auditEvents.Load(p.Context, key), nil
+				},
+			},
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"endCursor": &graphql.Field{
+				Type: graphql.String,
+			},
+			"hasNextPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+			},
+		},
+	})
+
+	noteConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "NoteConnection",
+		Fields: graphql.Fields{
+			"nodes": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(noteType))),
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(pageInfoType),
+			},
+		},
+	})
+
+	noteFilterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "NoteFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"titleContains": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "Case-insensitive substring of the title",
+			},
+			"createdAfter": &graphql.InputObjectFieldConfig{
+				Type: graphql.DateTime,
+			},
+			"createdBefore": &graphql.InputObjectFieldConfig{
+				Type: graphql.DateTime,
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"note": &graphql.Field{
+				Type: noteType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					return loadersFromContext(p.Context).notes.Load(p.Context, id), nil
+				},
+			},
+			"notes": &graphql.Field{
+				Type: graphql.NewNonNull(noteConnectionType),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: noteFilterType},
+					"first": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: defaultPageSize,
+						Description:  fmt.Sprintf("Page size, at most %d", maxPageSize),
+					},
+					"after": &graphql.ArgumentConfig{
+						Type:        graphql.String,
+						Description: "The endCursor of the previous page",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return resolveNotes(p, notes)
+				},
+			},
+		},
+	})
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createNote": &graphql.Field{
+				Type: graphql.NewNonNull(noteType),
+				Args: graphql.FieldConfigArgument{
+					"title": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					title, err := titleArg(p.Args["title"])
+					if err != nil {
+						return nil, err
+					}
+					note := models.NewNote(title)
+					if err := notes.CreateNote(p.Context, note); err != nil {
+						return nil, noteError(p.Context, err)
+					}
+					return note, nil
+				},
+			},
+			"updateNote": &graphql.Field{
+				Type: graphql.NewNonNull(noteType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"title": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					title, err := titleArg(p.Args["title"])
+					if err != nil {
+						return nil, err
+					}
+					note, err := notes.UpdateNote(p.Context, id, func(note *models.Note) error {
+						note.Title = title
+						return nil
+					})
+					if err != nil {
+						return nil, noteError(p.Context, err)
+					}
+					return note, nil
+				},
+			},
+			"deleteNote": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					if err := notes.DeleteNote(p.Context, id); err != nil {
+						return nil, noteError(p.Context, err)
+					}
+					return true, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    queryType,
+		Mutation: mutationType,
+	})
+}
+
+// resolveNotes returns one page of notes matching the filter arguments
+func resolveNotes(p graphql.ResolveParams, notes NoteStore) (interface{}, error) {
+	first, err := pageSize(p.Args["first"])
+	if err != nil {
+		return nil, err
+	}
+
+	filter := database.NoteFilter{Limit: first + 1}
+	if args, ok := p.Args["filter"].(map[string]interface{}); ok {
+		filter.TitleContains, _ = args["titleContains"].(string)
+		if t, ok := args["createdAfter"].(time.Time); ok {
+			filter.CreatedAfter = t
+		}
+		if t, ok := args["createdBefore"].(time.Time); ok {
+			filter.CreatedBefore = t
+		}
+	}
+	if after, ok := p.Args["after"].(string); ok {
+		cursor, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = cursor
+	}
+
+	page, err := notes.ListNotes(p.Context, filter)
+	if err != nil {
+		return nil, database.Internal(p.Context, err)
+	}
+
+	hasNextPage := len(page) > first
+	if hasNextPage {
+		page = page[:first]
+	}
+
+	// Seed the note loader so nested lookups of these notes need no extra query
+	noteLoader := loadersFromContext(p.Context).notes
+	for _, note := range page {
+		noteLoader.Prime(note.ID, note)
+	}
+
+	var endCursor interface{}
+	if len(page) > 0 {
+		endCursor = encodeCursor(page[len(page)-1])
+	}
+
+	return map[string]interface{}{
+		"nodes": page,
+		"pageInfo": map[string]interface{}{
+			"endCursor":   endCursor,
+			"hasNextPage": hasNextPage,
+		},
+	}, nil
+}
+
+// pageSize reads a first argument, which must be between 1 and maxPageSize
+func pageSize(arg interface{}) (int, error) {
+	first, _ := arg.(int)
+	if first < 1 || first > maxPageSize {
+		return 0, fmt.Errorf("first must be between 1 and %d", maxPageSize)
+	}
+	return first, nil
+}
+
+// encodeCursor returns the opaque pagination cursor pointing at a note
+func encodeCursor(note *models.Note) string {
+	raw := note.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + note.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(cursor string) (*database.NoteCursor, error) {
+	errInvalid := errors.New("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalid
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errInvalid
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, errInvalid
+	}
+	noteID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errInvalid
+	}
+	return &database.NoteCursor{CreatedAt: t, ID: noteID}, nil
+}
+
+// parseID parses a note ID argument
+func parseID(arg interface{}) (uuid.UUID, error) {
+	s, _ := arg.(string)
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, errors.New("invalid note ID")
+	}
+	return id, nil
+}
+
+// titleArg reads a title argument, checked with the rules shared by every API
+func titleArg(arg interface{}) (string, error) {
+	title, _ := arg.(string)
+	if fieldErrors := database.ValidateTitle(title); len(fieldErrors) > 0 {
+		return "", &database.ValidationError{Fields: fieldErrors}
+	}
+	return title, nil
+}
+
+// noteError maps repository errors for a single note to client-facing errors
+func noteError(ctx context.Context, err error) error {
+	var validationErr *database.ValidationError
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return errNoteNotFound
+	case errors.As(err, &validationErr):
+		return validationErr
+	}
+	return database.Internal(ctx, err)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditStore is the subset of database.AuditRepository used by AuditHandler
+type AuditStore interface {
+	ListEvents(ctx context.Context, filter database.AuditFilter) ([]*models.AuditEvent, error)
+	StreamEvents(ctx context.Context, filter database.AuditFilter, fn func(*models.AuditEvent) error) error
+}
+
+// AuditHandler handles HTTP requests for the audit log
+type AuditHandler struct {
+	auditRepo AuditStore
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditRepo AuditStore) *AuditHandler {
+	return &AuditHandler{
+		auditRepo: auditRepo,
+	}
+}
+
+// ListEvents handles the request to query the audit log
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, err.Error()))
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+
+	events, err := h.auditRepo.ListEvents(r.Context(), filter)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// ExportEvents streams the matching audit events as newline-delimited JSON
+func (h *AuditHandler) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	err = h.auditRepo.StreamEvents(r.Context(), filter, func(event *models.AuditEvent) error {
+		return encoder.Encode(event)
+	})
+	if err != nil {
+		// Headers are already sent, so the best we can do is stop the stream
+		log.Printf("request %s: failed to export audit events: %v", audit.FromContext(r.Context()).RequestID, err)
+	}
+}
+
+// parseAuditFilter reads the audit filters from the query string
+func parseAuditFilter(r *http.Request) (database.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := database.AuditFilter{
+		Action: query.Get("action"),
+	}
+
+	if noteID := query.Get("note_id"); noteID != "" {
+		id, err := uuid.Parse(noteID)
+		if err != nil {
+			return filter, errors.New("invalid note_id")
+		}
+		filter.NoteID = &id
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, errors.New("invalid from, expected RFC 3339 time")
+		}
+		filter.From = t
+	}
+
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, errors.New("invalid to, expected RFC 3339 time")
+		}
+		filter.To = t
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return filter, errors.New("invalid limit, expected 1-1000")
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
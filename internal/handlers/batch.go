@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+)
+
+// BatchRequest represents the request body for a note batch
+type BatchRequest struct {
+	Operations []BatchOperationRequest `json:"operations"`
+}
+
+// BatchOperationRequest is a single create, update or delete in a batch
+type BatchOperationRequest struct {
+	Op    string `json:"op"`
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// BatchResponse reports the outcome of every operation of a batch, in the
+// order they were submitted
+type BatchResponse struct {
+	Atomic    bool                   `json:"atomic"`
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Results   []BatchOperationResult `json:"results"`
+}
+
+// BatchOperationResult is the outcome of a single batch operation
+type BatchOperationResult struct {
+	Op     string           `json:"op"`
+	Status int              `json:"status"`
+	Note   any              `json:"note,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+// Batch handles the request to run several note writes at once. Batches are
+// atomic unless ?atomic=false is given, in which case every operation is
+// applied on its own and failures do not affect the others. The response is
+// 200 when every operation succeeded and 207 otherwise.
+func (h *NoteHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	atomic := true
+	if value := r.URL.Query().Get("atomic"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, "atomic must be a boolean"))
+			return
+		}
+		atomic = parsed
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	ops, fieldErrors := parseBatchOperations(req.Operations, h.maxBatchOperations)
+	if len(fieldErrors) > 0 {
+		problem.Write(w, r, problem.Validation(fieldErrors))
+		return
+	}
+
+	results, err := h.noteRepo.ExecBatch(r.Context(), ops, atomic)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	resp := BatchResponse{Atomic: atomic, Results: make([]BatchOperationResult, len(results))}
+	for i, result := range results {
+		if result.Err != nil {
+			p := problem.FromError(r, result.Err)
+			resp.Results[i] = BatchOperationResult{Op: ops[i].Op, Status: p.Status, Error: p}
+			resp.Failed++
+			continue
+		}
+		resp.Results[i] = BatchOperationResult{Op: ops[i].Op, Status: batchStatus(ops[i].Op), Note: h.presenter.Note(result.Note)}
+		resp.Succeeded++
+	}
+
+	status := http.StatusOK
+	if resp.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseBatchOperations validates the submitted operations and converts them
+// to repository operations
+func parseBatchOperations(reqs []BatchOperationRequest, maxOperations int) ([]database.BatchOperation, []database.FieldError) {
+	if len(reqs) == 0 {
+		return nil, []database.FieldError{{Field: "operations", Message: "must not be empty"}}
+	}
+	if len(reqs) > maxOperations {
+		return nil, []database.FieldError{{Field: "operations", Message: fmt.Sprintf("must contain at most %d operations", maxOperations)}}
+	}
+
+	var fieldErrors []database.FieldError
+	ops := make([]database.BatchOperation, len(reqs))
+	for i, req := range reqs {
+		prefix := fmt.Sprintf("operations[%d].", i)
+		op := database.BatchOperation{Op: req.Op}
+
+		switch req.Op {
+		case database.BatchCreate:
+			for _, fieldErr := range database.ValidateTitle(req.Title) {
+				fieldErrors = append(fieldErrors, database.FieldError{Field: prefix + fieldErr.Field, Message: fieldErr.Message})
+			}
+			op.Note = models.NewNote(req.Title)
+		case database.BatchUpdate, database.BatchDelete:
+			id, err := uuid.Parse(req.ID)
+			if err != nil {
+				fieldErrors = append(fieldErrors, database.FieldError{Field: prefix + "id", Message: "must be a UUID"})
+			}
+			op.ID = id
+			if req.Op == database.BatchUpdate {
+				for _, fieldErr := range database.ValidateTitle(req.Title) {
+					fieldErrors = append(fieldErrors, database.FieldError{Field: prefix + fieldErr.Field, Message: fieldErr.Message})
+				}
+				op.Title = req.Title
+			}
+		default:
+			fieldErrors = append(fieldErrors, database.FieldError{Field: prefix + "op", Message: "must be one of create, update, delete"})
+		}
+		ops[i] = op
+	}
+
+	return ops, fieldErrors
+}
+
+// batchStatus is the status reported for a successful batch operation
+func batchStatus(op string) int {
+	if op == database.BatchCreate {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
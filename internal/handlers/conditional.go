@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// noteETag is the strong entity tag of a note, which changes on every write
+func noteETag(note *models.Note) string {
+	return fmt.Sprintf(`"%x"`, note.UpdatedAt.UnixMicro())
+}
+
+// variantETag derives the entity tag of another representation of the same
+// resource, since a strong entity tag must differ between representations
+func variantETag(etag, mediaType string) string {
+	return strings.TrimSuffix(etag, `"`) + "-" + strings.ReplaceAll(mediaType, "/", "-") + `"`
+}
+
+// notesETag is the strong entity tag of the notes collection
+func notesETag(version *database.NotesVersion) string {
+	return fmt.Sprintf(`"%x-%x"`, version.Version, version.LastModified.UnixMicro())
+}
+
+// setValidators sets the ETag and Last-Modified headers of a response
+func setValidators(w http.ResponseWriter, etag string, lastModified time.Time) {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified reports whether the client already holds the current
+// representation, following RFC 9110: If-None-Match takes precedence and
+// If-Modified-Since is only consulted when it is absent
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return false
+		}
+		// HTTP dates have a resolution of one second
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// writeNotModified sends a 304 carrying the current validators
+func writeNotModified(w http.ResponseWriter, etag string, lastModified time.Time) {
+	setValidators(w, etag, lastModified)
+	w.WriteHeader(http.StatusNotModified)
+}
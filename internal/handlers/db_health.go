@@ -3,9 +3,11 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
+	"github.com/moabdelazem/noter/internal/audit"
 	"github.com/moabdelazem/noter/internal/database"
 )
 
@@ -28,10 +30,12 @@ func DBHealthHandler(db *database.DB) http.HandlerFunc {
 		// Ping the database
 		err := db.Ping(ctx)
 		if err != nil {
+			// Log the cause instead of exposing database details to clients
+			log.Printf("request %s: database health check failed: %v", audit.FromContext(r.Context()).RequestID, err)
 			w.WriteHeader(http.StatusServiceUnavailable)
 			json.NewEncoder(w).Encode(DBHealth{
 				Status:    "error",
-				Message:   "Database connection failed: " + err.Error(),
+				Message:   "Database connection failed",
 				Timestamp: time.Now().Format(time.RFC3339),
 			})
 			return
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/events"
+	"github.com/moabdelazem/noter/internal/problem"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment to keep
+// proxies from closing it
+const eventsHeartbeat = 15 * time.Second
+
+// EventHandler handles HTTP requests for the note change stream
+type EventHandler struct {
+	broker *events.Broker
+}
+
+// NewEventHandler creates a new event handler
+func NewEventHandler(broker *events.Broker) *EventHandler {
+	return &EventHandler{
+		broker: broker,
+	}
+}
+
+// Stream handles the request to follow note changes as Server-Sent Events.
+// Clients reconnecting with Last-Event-ID get the events they missed from
+// the replay buffer, or a reset event when those are no longer available
+// and they must reload the notes.
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem.Error(w, r, fmt.Errorf("response writer does not support flushing"))
+		return
+	}
+
+	sub, resumed := h.broker.Subscribe(r.Header.Get("Last-Event-ID"))
+	defer h.broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !resumed {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range sub.Replay {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a single event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, event events.Event) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
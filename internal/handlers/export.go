@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+)
+
+// maxSlugLength bounds the title part of exported file names
+const maxSlugLength = 60
+
+// ExportStore is the subset of database.NoteRepository used by ExportHandler
+type ExportStore interface {
+	StreamNotes(ctx context.Context, filter database.NoteFilter, fn func(*models.Note) error) error
+	ExportNotes(ctx context.Context, fn func(*models.Note) error) error
+}
+
+// ExportHandler handles HTTP requests exporting notes
+type ExportHandler struct {
+	noteRepo ExportStore
+}
+
+// NewExportHandler creates a new export handler
+func NewExportHandler(noteRepo ExportStore) *ExportHandler {
+	return &ExportHandler{
+		noteRepo: noteRepo,
+	}
+}
+
+// ExportMarkdown streams every matching note as a Markdown file with YAML
+// front matter inside a zip. Notes are written to the archive as they are
+// read from the database, so the export never holds all of them in memory.
+func (h *ExportHandler) ExportMarkdown(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="noter-%s.zip"`, time.Now().UTC().Format("20060102-150405")))
+
+	archive := zip.NewWriter(w)
+	err = h.noteRepo.StreamNotes(r.Context(), filter, func(note *models.Note) error {
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     markdownFileName(note),
+			Method:   zip.Deflate,
+			Modified: note.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		return renderNoteMarkdown(file, note, nil)
+	})
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		// Headers are already sent, so the best we can do is stop the stream,
+		// which leaves the client with a truncated archive it cannot open
+		log.Printf("request %s: failed to export notes as Markdown: %v", audit.FromContext(r.Context()).RequestID, err)
+	}
+}
+
+// ExportNDJSON streams every note as newline-delimited JSON, oldest first,
+// in the format accepted by POST /import.ndjson
+func (h *ExportHandler) ExportNDJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	err := h.noteRepo.ExportNotes(r.Context(), func(note *models.Note) error {
+		return encoder.Encode(note)
+	})
+	if err != nil {
+		// Headers are already sent, so the best we can do is stop the stream
+		log.Printf("request %s: failed to export notes as NDJSON: %v", audit.FromContext(r.Context()).RequestID, err)
+	}
+}
+
+// parseExportFilter reads the export filters from the query string
+func parseExportFilter(r *http.Request) (database.NoteFilter, error) {
+	query := r.URL.Query()
+	var filter database.NoteFilter
+
+	if after := query.Get("created_after"); after != "" {
+		t, err := time.Parse(time.RFC3339, after)
+		if err != nil {
+			return filter, errors.New("invalid created_after, expected RFC 3339 time")
+		}
+		filter.CreatedAfter = t
+	}
+
+	if before := query.Get("created_before"); before != "" {
+		t, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			return filter, errors.New("invalid created_before, expected RFC 3339 time")
+		}
+		filter.CreatedBefore = t
+	}
+
+	return filter, nil
+}
+
+// slugUnsafe matches the runs of characters left out of file names
+var slugUnsafe = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// markdownFileName names the file of a note after its title and ID. The ID
+// keeps names unique and stable across exports, so a backup kept in git
+// only sees the notes that changed.
+func markdownFileName(note *models.Note) string {
+	slug := strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(note.Title), "-"), "-")
+	if runes := []rune(slug); len(runes) > maxSlugLength {
+		slug = strings.TrimRight(string(runes[:maxSlugLength]), "-")
+	}
+	if slug == "" {
+		return note.ID.String() + ".md"
+	}
+	return slug + "-" + note.ID.String() + ".md"
+}
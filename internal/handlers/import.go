@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+)
+
+const (
+	// maxImportLineLength is the longest line an NDJSON import may contain
+	maxImportLineLength = 64 << 10
+	// maxImportErrors is how many invalid lines are listed in an import summary
+	maxImportErrors = 100
+	// maxImportClockSkew is how far ahead of this server's clock an imported
+	// timestamp may be, for exports taken on a host whose clock runs fast
+	maxImportClockSkew = time.Minute
+)
+
+// ImportStore is the subset of database.NoteRepository used by ImportHandler
+type ImportStore interface {
+	ImportNotes(ctx context.Context, next func() (*models.Note, error)) (*database.ImportResult, error)
+}
+
+// ImportHandler handles HTTP requests importing notes
+type ImportHandler struct {
+	noteRepo ImportStore
+}
+
+// NewImportHandler creates a new import handler
+func NewImportHandler(noteRepo ImportStore) *ImportHandler {
+	return &ImportHandler{
+		noteRepo: noteRepo,
+	}
+}
+
+// ImportResponse summarizes an import. Errors lists the first invalid
+// lines, which were skipped while the valid ones were imported.
+type ImportResponse struct {
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Failed    int               `json:"failed"`
+	Errors    []ImportLineError `json:"errors"`
+}
+
+// ImportLineError describes why a line of an import was skipped
+type ImportLineError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ImportNDJSON handles the request to import notes from newline-delimited
+// JSON, one note per line in the format of GET /export.ndjson. Lines are
+// read and copied to the database as they arrive, so imports of any size
+// run in constant memory. New notes keep their IDs and timestamps when
+// given; existing notes are only overwritten by copies edited after them.
+// A timestamp in the future aborts the whole import.
+func (h *ImportHandler) ImportNDJSON(w http.ResponseWriter, r *http.Request) {
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLineLength)
+
+	resp := ImportResponse{Errors: []ImportLineError{}}
+	line := 0
+	next := func() (*models.Note, error) {
+		for scanner.Scan() {
+			line++
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			note, fieldErrors := parseImportedNote(scanner.Bytes())
+			if len(fieldErrors) > 0 {
+				resp.Failed++
+				for _, fieldError := range fieldErrors {
+					if len(resp.Errors) < maxImportErrors {
+						resp.Errors = append(resp.Errors, ImportLineError{Line: line, Field: fieldError.Field, Message: fieldError.Message})
+					}
+				}
+				continue
+			}
+			// A note edited in the future could never be overwritten by a
+			// later import, nor its updated_at advance when edited here
+			if field := futureTimestamp(note, time.Now().Add(maxImportClockSkew)); field != "" {
+				detail := fmt.Sprintf("Line %d: %s is in the future", line, field)
+				return nil, problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, detail)
+			}
+			return note, nil
+		}
+
+		if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+			detail := fmt.Sprintf("Line %d is longer than %d bytes", line+1, maxImportLineLength)
+			return nil, problem.New(http.StatusRequestEntityTooLarge, problem.CodeRequestTooLarge, detail)
+		}
+		return nil, scanner.Err()
+	}
+
+	result, err := h.noteRepo.ImportNotes(r.Context(), next)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	resp.Created = result.Created
+	resp.Updated = result.Updated
+	resp.Unchanged = result.Unchanged
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// importedNote is a line of an import before it is validated
+type importedNote struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// parseImportedNote decodes and validates a single line of an import.
+// Notes without an ID get a new one, and missing timestamps are set to now.
+func parseImportedNote(line []byte) (*models.Note, []database.FieldError) {
+	var imported importedNote
+	if err := json.Unmarshal(line, &imported); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, []database.FieldError{{Field: typeErr.Field, Message: "has the wrong type"}}
+		}
+		return nil, []database.FieldError{{Field: "note", Message: "must be a JSON object"}}
+	}
+
+	note := &models.Note{ID: uuid.New(), Title: imported.Title}
+	fieldErrors := database.ValidateTitle(imported.Title)
+	if imported.ID != "" {
+		id, err := uuid.Parse(imported.ID)
+		if err != nil {
+			fieldErrors = append(fieldErrors, database.FieldError{Field: "id", Message: "must be a UUID"})
+		}
+		note.ID = id
+	}
+
+	now := time.Now()
+	note.CreatedAt, fieldErrors = parseImportedTime("created_at", imported.CreatedAt, now, fieldErrors)
+	note.UpdatedAt, fieldErrors = parseImportedTime("updated_at", imported.UpdatedAt, note.CreatedAt, fieldErrors)
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors
+	}
+	return note, nil
+}
+
+// futureTimestamp returns the first timestamp of an imported note that is
+// after limit, or "" when there is none
+func futureTimestamp(note *models.Note, limit time.Time) string {
+	switch {
+	case note.CreatedAt.After(limit):
+		return "created_at"
+	case note.UpdatedAt.After(limit):
+		return "updated_at"
+	}
+	return ""
+}
+
+// parseImportedTime parses an RFC 3339 timestamp of an imported note,
+// falling back to fallback when it is missing
+func parseImportedTime(field, value string, fallback time.Time, fieldErrors []database.FieldError) (time.Time, []database.FieldError) {
+	if value == "" {
+		return fallback, fieldErrors
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return fallback, append(fieldErrors, database.FieldError{Field: field, Message: "must be an RFC 3339 date-time"})
+	}
+	return t, fieldErrors
+}
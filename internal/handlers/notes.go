@@ -1,25 +1,49 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/audit"
 	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/jsonpatch"
 	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
 )
 
+// NoteStore is the subset of database.NoteRepository used by NoteHandler
+type NoteStore interface {
+	CreateNote(ctx context.Context, note *models.Note) error
+	GetNotesVersion(ctx context.Context) (*database.NotesVersion, error)
+	GetAllNotes(ctx context.Context) ([]*models.Note, error)
+	GetNoteByID(ctx context.Context, id uuid.UUID) (*models.Note, error)
+	UpdateNote(ctx context.Context, id uuid.UUID, fn func(*models.Note) error) (*models.Note, error)
+	ExecBatch(ctx context.Context, ops []database.BatchOperation, atomic bool) ([]database.BatchResult, error)
+}
+
 // NoteHandler handles HTTP requests for notes
 type NoteHandler struct {
-	noteRepo *database.NoteRepository
+	noteRepo           NoteStore
+	presenter          Presenter
+	maxBatchOperations int
 }
 
-// NewNoteHandler creates a new note handler
-func NewNoteHandler(noteRepo *database.NoteRepository) *NoteHandler {
+// NewNoteHandler creates a new note handler that shapes its responses with
+// presenter and accepts batches of up to maxBatchOperations operations
+func NewNoteHandler(noteRepo NoteStore, presenter Presenter, maxBatchOperations int) *NoteHandler {
 	return &NoteHandler{
-		noteRepo: noteRepo,
+		noteRepo:           noteRepo,
+		presenter:          presenter,
+		maxBatchOperations: maxBatchOperations,
 	}
 }
 
@@ -32,55 +56,191 @@ type CreateNoteRequest struct {
 func (h *NoteHandler) CreateNote(w http.ResponseWriter, r *http.Request) {
 	var req CreateNoteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
-	if req.Title == "" {
-		http.Error(w, "Title is required", http.StatusBadRequest)
+	if fieldErrors := database.ValidateTitle(req.Title); len(fieldErrors) > 0 {
+		problem.Write(w, r, problem.Validation(fieldErrors))
 		return
 	}
 
 	note := models.NewNote(req.Title)
 	if err := h.noteRepo.CreateNote(r.Context(), note); err != nil {
-		errMsg := fmt.Sprintf("Failed to create note: %v", err)
-		http.Error(w, errMsg, http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
+	setValidators(w, noteETag(note), note.UpdatedAt)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(note)
+	json.NewEncoder(w).Encode(h.presenter.Note(note))
 }
 
-// GetAllNotes handles the request to get all notes
+// GetAllNotes handles the request to get all notes. The collection's
+// validators are computed before the notes are loaded, so polling clients
+// holding the current version get a 304 without the notes being read.
 func (h *NoteHandler) GetAllNotes(w http.ResponseWriter, r *http.Request) {
+	version, err := h.noteRepo.GetNotesVersion(r.Context())
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	etag := notesETag(version)
+	if notModified(r, etag, version.LastModified) {
+		writeNotModified(w, etag, version.LastModified)
+		return
+	}
+
 	notes, err := h.noteRepo.GetAllNotes(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to get notes", http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
+	setValidators(w, etag, version.LastModified)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notes)
+	json.NewEncoder(w).Encode(h.presenter.Notes(notes))
 }
 
-// GetNoteByID handles the request to get a note by ID
+// GetNoteByID handles the request to get a note by ID, in whichever of the
+// registered media types the Accept header prefers
 func (h *NoteHandler) GetNoteByID(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	id, err := uuid.Parse(idStr)
+	id, err := noteIDFromRequest(r)
 	if err != nil {
-		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	mediaType, renderer, ok := negotiateNoteRenderer(r.Header.Get("Accept"))
+	if !ok {
+		problem.Write(w, r, problem.New(http.StatusNotAcceptable, problem.CodeNotAcceptable, "None of the accepted media types is available"))
 		return
 	}
 
 	note, err := h.noteRepo.GetNoteByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Note not found", http.StatusNotFound)
+		problem.Error(w, r, err)
+		return
+	}
+
+	etag := noteETag(note)
+	if mediaType != mediaTypeJSON {
+		etag = variantETag(etag, mediaType)
+	}
+	if notModified(r, etag, note.UpdatedAt) {
+		writeNotModified(w, etag, note.UpdatedAt)
+		return
+	}
+
+	setValidators(w, etag, note.UpdatedAt)
+	contentType := mediaType
+	if strings.HasPrefix(mediaType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if err := renderer.Render(w, note, h.presenter); err != nil {
+		log.Printf("request %s: failed to render note as %s: %v", audit.FromContext(r.Context()).RequestID, mediaType, err)
+	}
+}
+
+// PatchNote handles the request to partially update a note with either a
+// JSON Merge Patch or a JSON Patch document. The patch is applied to the
+// stored note while its row is locked, and the result is validated before
+// it is saved.
+func (h *NoteHandler) PatchNote(w http.ResponseWriter, r *http.Request) {
+	id, err := noteIDFromRequest(r)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	var applyPatch func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case jsonpatch.MergePatchType:
+		applyPatch = jsonpatch.MergePatch
+	case jsonpatch.JSONPatchType:
+		applyPatch = jsonpatch.Apply
+	default:
+		detail := "Content-Type must be " + jsonpatch.MergePatchType + " or " + jsonpatch.JSONPatchType
+		problem.Write(w, r, problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, detail))
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequestBody, "Invalid request body"))
 		return
 	}
 
+	note, err := h.noteRepo.UpdateNote(r.Context(), id, func(note *models.Note) error {
+		doc, err := json.Marshal(note)
+		if err != nil {
+			return err
+		}
+		patched, err := applyPatch(doc, patch)
+		if err != nil {
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				return problem.New(http.StatusConflict, problem.CodePatchTestFailed, err.Error())
+			}
+			return problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidPatch, err.Error())
+		}
+		return applyPatchedNote(note, patched)
+	})
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	setValidators(w, noteETag(note), note.UpdatedAt)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(note)
+	json.NewEncoder(w).Encode(h.presenter.Note(note))
+}
+
+// applyPatchedNote copies the editable fields of a patched note document onto
+// note, rejecting unknown fields and changes to read-only ones
+func applyPatchedNote(note *models.Note, patched []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+
+	var result models.Note
+	if err := decoder.Decode(&result); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return &database.ValidationError{Fields: []database.FieldError{{Field: typeErr.Field, Message: "has the wrong type"}}}
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return &database.ValidationError{Fields: []database.FieldError{{Field: strings.Trim(field, `"`), Message: "is not allowed"}}}
+		}
+		return &database.ValidationError{Fields: []database.FieldError{{Field: "note", Message: "must be an object"}}}
+	}
+
+	var fieldErrors []database.FieldError
+	if result.ID != note.ID {
+		fieldErrors = append(fieldErrors, database.FieldError{Field: "id", Message: "is read-only"})
+	}
+	if !result.CreatedAt.Equal(note.CreatedAt) {
+		fieldErrors = append(fieldErrors, database.FieldError{Field: "created_at", Message: "is read-only"})
+	}
+	if !result.UpdatedAt.Equal(note.UpdatedAt) {
+		fieldErrors = append(fieldErrors, database.FieldError{Field: "updated_at", Message: "is read-only"})
+	}
+	fieldErrors = append(fieldErrors, database.ValidateTitle(result.Title)...)
+	if len(fieldErrors) > 0 {
+		return &database.ValidationError{Fields: fieldErrors}
+	}
+
+	note.Title = result.Title
+	return nil
+}
+
+// noteIDFromRequest parses the note ID path variable
+func noteIDFromRequest(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return uuid.Nil, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid note ID")
+	}
+	return id, nil
 }
@@ -0,0 +1,23 @@
+package handlers
+
+import "github.com/moabdelazem/noter/internal/models"
+
+// Presenter shapes the notes a version of the API returns, so a new version
+// can change its responses while sharing the handlers of the previous one
+type Presenter interface {
+	Note(note *models.Note) any
+	Notes(notes []*models.Note) any
+}
+
+// V1Presenter returns notes exactly as they are stored
+type V1Presenter struct{}
+
+// Note returns the note unchanged
+func (V1Presenter) Note(note *models.Note) any {
+	return note
+}
+
+// Notes returns the notes unchanged
+func (V1Presenter) Notes(notes []*models.Note) any {
+	return notes
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// Renderer writes a note in a single media type. The presenter shapes the
+// note for the API version serving it, for formats that follow it.
+type Renderer interface {
+	Render(w io.Writer, note *models.Note, presenter Presenter) error
+}
+
+// RendererFunc adapts a function to the Renderer interface
+type RendererFunc func(w io.Writer, note *models.Note, presenter Presenter) error
+
+// Render calls f
+func (f RendererFunc) Render(w io.Writer, note *models.Note, presenter Presenter) error {
+	return f(w, note, presenter)
+}
+
+// noteRenderers holds the media types a note can be served as, in the
+// order of preference used when the client accepts several equally
+var noteRenderers = struct {
+	sync.RWMutex
+	mediaTypes []string
+	renderers  map[string]Renderer
+}{renderers: make(map[string]Renderer)}
+
+// RegisterNoteRenderer makes notes available in another media type, or
+// replaces the renderer of one already registered
+func RegisterNoteRenderer(mediaType string, renderer Renderer) {
+	noteRenderers.Lock()
+	defer noteRenderers.Unlock()
+
+	if _, ok := noteRenderers.renderers[mediaType]; !ok {
+		noteRenderers.mediaTypes = append(noteRenderers.mediaTypes, mediaType)
+	}
+	noteRenderers.renderers[mediaType] = renderer
+}
+
+// negotiateNoteRenderer picks the renderer best matching an Accept header
+func negotiateNoteRenderer(accept string) (string, Renderer, bool) {
+	noteRenderers.RLock()
+	defer noteRenderers.RUnlock()
+
+	mediaType, ok := NegotiateMediaType(accept, noteRenderers.mediaTypes)
+	if !ok {
+		return "", nil, false
+	}
+	return mediaType, noteRenderers.renderers[mediaType], true
+}
+
+// NegotiateMediaType picks the offered media type the Accept header prefers,
+// following RFC 9110: the most specific matching range sets the quality of
+// each offer, and ties go to the earlier offer. A missing header accepts
+// anything.
+func NegotiateMediaType(accept string, offered []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		if len(offered) == 0 {
+			return "", false
+		}
+		return offered[0], true
+	}
+
+	type mediaRange struct {
+		typ, subtype string
+		quality      float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ, subtype, quality})
+	}
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offered {
+		typ, subtype, _ := strings.Cut(offer, "/")
+		quality, specificity := 0.0, -1
+		for _, r := range ranges {
+			var s int
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*" && r.subtype == "*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				quality, specificity = r.quality, s
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+
+	return best, best != ""
+}
+
+// The media types notes are available in out of the box
+const (
+	mediaTypeJSON     = "application/json"
+	mediaTypeMarkdown = "text/markdown"
+	mediaTypeHTML     = "text/html"
+	mediaTypeText     = "text/plain"
+)
+
+func init() {
+	RegisterNoteRenderer(mediaTypeJSON, RendererFunc(renderNoteJSON))
+	RegisterNoteRenderer(mediaTypeMarkdown, RendererFunc(renderNoteMarkdown))
+	RegisterNoteRenderer(mediaTypeHTML, RendererFunc(renderNoteHTML))
+	RegisterNoteRenderer(mediaTypeText, RendererFunc(renderNoteText))
+}
+
+// renderNoteJSON writes the note as the API version presents it
+func renderNoteJSON(w io.Writer, note *models.Note, presenter Presenter) error {
+	return json.NewEncoder(w).Encode(presenter.Note(note))
+}
+
+// markdownEscaper backslash-escapes the characters that start inline
+// Markdown, such as emphasis, code, links, HTML and entities, and the #
+// that would otherwise be read as the closing sequence of a heading
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `\<`, `>`, `\>`, `&`, `\&`, `#`, `\#`, `~`, `\~`,
+)
+
+// renderNoteMarkdown writes the note as Markdown with its metadata in YAML
+// front matter. The title is written as a JSON string, which is valid YAML
+// whatever characters it contains. In the heading it is flattened onto a
+// single line, so line breaks cannot end the heading or start a new block,
+// and escaped, so it reads as the literal text of the title.
+func renderNoteMarkdown(w io.Writer, note *models.Note, _ Presenter) error {
+	title, err := json.Marshal(note.Title)
+	if err != nil {
+		return err
+	}
+	heading := markdownEscaper.Replace(strings.Join(strings.Fields(note.Title), " "))
+	_, err = fmt.Fprintf(w, "---\nid: %s\ntitle: %s\ncreated_at: %s\nupdated_at: %s\n---\n\n# %s\n",
+		note.ID, title, note.CreatedAt.UTC().Format(time.RFC3339Nano), note.UpdatedAt.UTC().Format(time.RFC3339Nano), heading)
+	return err
+}
+
+// noteHTML is the page a note is rendered to
+var noteHTML = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<article>
+<h1>{{.Title}}</h1>
+<p><small>Created <time datetime="{{.CreatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.UTC.Format "2006-01-02 15:04 MST"}}</time>,
+updated <time datetime="{{.UpdatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.UpdatedAt.UTC.Format "2006-01-02 15:04 MST"}}</time></small></p>
+</article>
+</body>
+</html>
+`))
+
+// renderNoteHTML writes the note as a standalone HTML page
+func renderNoteHTML(w io.Writer, note *models.Note, _ Presenter) error {
+	return noteHTML.Execute(w, note)
+}
+
+// renderNoteText writes the note's title as plain text
+func renderNoteText(w io.Writer, note *models.Note, _ Presenter) error {
+	_, err := fmt.Fprintln(w, note.Title)
+	return err
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/moabdelazem/noter/internal/webhooks"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+	maxWebhookURLLength    = 2048
+	minWebhookSecretLength = 32
+	maxWebhookSecretLength = 255
+)
+
+// WebhookStore is the subset of database.WebhookRepository used by WebhookHandler
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	ListWebhooks(ctx context.Context) ([]*models.Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, id uuid.UUID, update database.WebhookUpdate) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]*models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, webhookID uuid.UUID, deliveryID int64) (*models.WebhookDelivery, error)
+}
+
+// WebhookHandler handles HTTP requests for webhook subscriptions
+type WebhookHandler struct {
+	webhookRepo     WebhookStore
+	allowedNetworks []netip.Prefix
+}
+
+// NewWebhookHandler creates a new webhook handler. URLs must point to public
+// addresses, or to addresses in one of allowedNetworks.
+func NewWebhookHandler(webhookRepo WebhookStore, allowedNetworks []netip.Prefix) *WebhookHandler {
+	return &WebhookHandler{
+		webhookRepo:     webhookRepo,
+		allowedNetworks: allowedNetworks,
+	}
+}
+
+// CreateWebhookRequest represents the request body for creating a webhook
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+// UpdateWebhookRequest represents the request body for updating a webhook
+type UpdateWebhookRequest struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+// CreatedWebhookResponse is a newly created webhook along with its signing
+// secret, which is not shown again
+type CreatedWebhookResponse struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook handles the request to subscribe a URL to note events. A
+// signing secret is generated unless one is given, which must be at least
+// minWebhookSecretLength bytes long.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	fieldErrors := append(validateWebhookURL(req.URL, h.allowedNetworks), validateEventTypes(req.EventTypes)...)
+	if req.Secret != "" && len(req.Secret) < minWebhookSecretLength {
+		fieldErrors = append(fieldErrors, database.FieldError{Field: "secret", Message: "must be at least " + strconv.Itoa(minWebhookSecretLength) + " bytes"})
+	}
+	if len(req.Secret) > maxWebhookSecretLength {
+		fieldErrors = append(fieldErrors, database.FieldError{Field: "secret", Message: "must be at most " + strconv.Itoa(maxWebhookSecretLength) + " characters"})
+	}
+	if len(fieldErrors) > 0 {
+		problem.Write(w, r, problem.Validation(fieldErrors))
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := webhooks.NewSecret()
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		secret = generated
+	}
+
+	now := time.Now()
+	webhook := &models.Webhook{
+		ID:         uuid.New(),
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     secret,
+		Active:     true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := h.webhookRepo.CreateWebhook(r.Context(), webhook); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedWebhookResponse{Webhook: webhook, Secret: secret})
+}
+
+// ListWebhooks handles the request to get all webhooks
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	list, err := h.webhookRepo.ListWebhooks(r.Context())
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetWebhook handles the request to get a webhook by ID
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookIDFromRequest(r)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	webhook, err := h.webhookRepo.GetWebhook(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// UpdateWebhook handles the request to change a webhook. Setting active to
+// true re-enables a webhook that was disabled after failing repeatedly.
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookIDFromRequest(r)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	var req UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+
+	var fieldErrors []database.FieldError
+	if req.URL != nil {
+		fieldErrors = append(fieldErrors, validateWebhookURL(*req.URL, h.allowedNetworks)...)
+	}
+	if req.EventTypes != nil {
+		fieldErrors = append(fieldErrors, validateEventTypes(req.EventTypes)...)
+	}
+	if len(fieldErrors) > 0 {
+		problem.Write(w, r, problem.Validation(fieldErrors))
+		return
+	}
+
+	webhook, err := h.webhookRepo.UpdateWebhook(r.Context(), id, database.WebhookUpdate{
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Active:     req.Active,
+	})
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// DeleteWebhook handles the request to remove a webhook and its delivery log
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookIDFromRequest(r)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	if err := h.webhookRepo.DeleteWebhook(r.Context(), id); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries handles the request to get the latest deliveries of a webhook
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookIDFromRequest(r)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, "limit must be between 1 and "+strconv.Itoa(maxDeliveriesLimit)))
+			return
+		}
+	}
+
+	deliveries, err := h.webhookRepo.ListDeliveries(r.Context(), id, limit)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// Redeliver handles the request to send the event of an earlier delivery
+// again. The new delivery is queued and attempted by the worker, which only
+// sends to active webhooks, so inactive ones are refused with 409.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, err := webhookIDFromRequest(r)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(mux.Vars(r)["deliveryID"], 10, 64)
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid delivery ID"))
+		return
+	}
+
+	webhook, err := h.webhookRepo.GetWebhook(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if !webhook.Active {
+		detail := "The webhook is inactive; set active to true before redelivering"
+		problem.Write(w, r, problem.New(http.StatusConflict, problem.CodeWebhookInactive, detail))
+		return
+	}
+
+	delivery, err := h.webhookRepo.Redeliver(r.Context(), id, deliveryID)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute HTTP(S) URL
+// that does not name a non-public address. Host names are only checked by
+// the worker, against the addresses they resolve to when a delivery is sent.
+func validateWebhookURL(raw string, allowedNetworks []netip.Prefix) []database.FieldError {
+	if raw == "" {
+		return []database.FieldError{{Field: "url", Message: "is required"}}
+	}
+	if len(raw) > maxWebhookURLLength {
+		return []database.FieldError{{Field: "url", Message: "must be at most " + strconv.Itoa(maxWebhookURLLength) + " characters"}}
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return []database.FieldError{{Field: "url", Message: "must be an absolute http or https URL"}}
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if addr, err := netip.ParseAddr(host); err == nil && !webhooks.AllowedDestination(addr, allowedNetworks) {
+		return []database.FieldError{{Field: "url", Message: "must not point to a private, loopback or link-local address"}}
+	}
+	isLocalhost := host == "localhost" || strings.HasSuffix(host, ".localhost")
+	if isLocalhost && !webhooks.AllowedDestination(netip.MustParseAddr("127.0.0.1"), allowedNetworks) &&
+		!webhooks.AllowedDestination(netip.IPv6Loopback(), allowedNetworks) {
+		return []database.FieldError{{Field: "url", Message: "must not point to a private, loopback or link-local address"}}
+	}
+	return nil
+}
+
+// validateEventTypes checks that a webhook subscribes to known event types
+func validateEventTypes(eventTypes []string) []database.FieldError {
+	if len(eventTypes) == 0 {
+		return []database.FieldError{{Field: "event_types", Message: "must not be empty"}}
+	}
+	var fieldErrors []database.FieldError
+	for i, eventType := range eventTypes {
+		if !slices.Contains(webhooks.EventTypes, eventType) {
+			fieldErrors = append(fieldErrors, database.FieldError{
+				Field:   "event_types[" + strconv.Itoa(i) + "]",
+				Message: "is not a known event type",
+			})
+		}
+	}
+	return fieldErrors
+}
+
+// webhookIDFromRequest parses the webhook ID path variable
+func webhookIDFromRequest(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		return uuid.Nil, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid webhook ID")
+	}
+	return id, nil
+}
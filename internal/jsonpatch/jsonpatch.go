@@ -0,0 +1,380 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the supported patch formats
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalidPatch is returned when a patch is malformed or cannot be applied
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrTestFailed is returned when a JSON Patch test operation does not match
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// Operation is a single JSON Patch operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7396 section 2
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// Apply applies an RFC 6902 JSON Patch to doc. The operations are applied in
+// order and either all succeed or doc is left untouched.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: patch must be an array of operations", ErrInvalidPatch)
+	}
+
+	for i, op := range ops {
+		target, err = apply(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+// apply runs a single operation and returns the new document
+func apply(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: value is required", ErrInvalidPatch)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if _, err := get(doc, path); err != nil {
+				return nil, err
+			}
+			if doc, _, err = remove(doc, path); err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+			}
+			if doc, value, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			if value, err = get(doc, from); err != nil {
+				return nil, err
+			}
+			value = deepCopy(value)
+		}
+		return add(doc, path, value)
+	}
+
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// get returns the value at path
+func get(doc any, path []string) (any, error) {
+	current := doc
+	for _, token := range path {
+		switch container := current.(type) {
+		case map[string]any:
+			value, ok := container[token]
+			if !ok {
+				return nil, pathError(path)
+			}
+			current = value
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, pathError(path)
+			}
+			current = container[index]
+		default:
+			return nil, pathError(path)
+		}
+	}
+	return current, nil
+}
+
+// add inserts value at path and returns the new document
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		container[token] = value
+		return doc, nil
+	case []any:
+		index := len(container)
+		if token != "-" {
+			if index, err = arrayIndex(token, len(container)); err != nil {
+				return nil, pathError(path)
+			}
+		}
+		grown := append(container[:index:index], value)
+		grown = append(grown, container[index:]...)
+		return replaceContainer(doc, path[:len(path)-1], grown)
+	}
+	return nil, pathError(path)
+}
+
+// remove deletes the value at path and returns the new document and the removed value
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		value, ok := container[token]
+		if !ok {
+			return nil, nil, pathError(path)
+		}
+		delete(container, token)
+		return doc, value, nil
+	case []any:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, nil, pathError(path)
+		}
+		value := container[index]
+		shrunk := append(container[:index:index], container[index+1:]...)
+		doc, err = replaceContainer(doc, path[:len(path)-1], shrunk)
+		return doc, value, err
+	}
+	return nil, nil, pathError(path)
+}
+
+// replaceContainer stores a resized array back at path, since slices
+// cannot grow or shrink in place
+func replaceContainer(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		container[token] = value
+	case []any:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, pathError(path)
+		}
+		container[index] = value
+	}
+	return doc, nil
+}
+
+// arrayIndex parses an array index token no greater than max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidPatch
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max {
+		return 0, ErrInvalidPatch
+	}
+	return index, nil
+}
+
+// isPrefix reports whether prefix is a prefix of path
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// pathError reports a path that does not exist in the document
+func pathError(path []string) error {
+	return fmt.Errorf("%w: path /%s does not exist", ErrInvalidPatch, strings.Join(path, "/"))
+}
+
+// decode parses JSON, keeping numbers exact
+func decode(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+// deepCopy copies a decoded JSON value so later operations cannot alias it
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// equal compares decoded JSON values, treating numbers by their numeric value
+func equal(a, b any) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aErr := av.Float64()
+		bf, bErr := bv.Float64()
+		return aErr == nil && bErr == nil && af == bf
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, ok := bv[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
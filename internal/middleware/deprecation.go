@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecated is a middleware for routes that are scheduled for removal. It
+// announces when they were deprecated (RFC 9745) and when they stop working
+// (RFC 8594), and links to the same resource in the successor version,
+// which lives under successorPrefix.
+func Deprecated(deprecatedAt, sunset time.Time, successorPrefix string) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetDate)
+			w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, successorPrefix, r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
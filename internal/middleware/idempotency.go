@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+)
+
+// IdempotencyKeyHeader is the header clients use to make a request safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marks a response replayed from an earlier request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength is the longest key the idempotency table can store
+const maxIdempotencyKeyLength = 255
+
+// idempotencyLease is how long a key stays claimed by a request that never
+// completes, such as one cut short by a crash, before it can be retried
+const idempotencyLease = 10 * time.Minute
+
+// idempotencyWait bounds how long a request waits for another request with
+// the same key to complete, after which it is rejected with 409
+const idempotencyWait = 30 * time.Second
+
+// idempotencyPollInterval is how often a waiting request checks whether the
+// request holding its key has completed
+const idempotencyPollInterval = 100 * time.Millisecond
+
+// IdempotencyStore persists the responses of idempotent requests
+type IdempotencyStore interface {
+	Claim(ctx context.Context, key string, lease time.Duration) (bool, error)
+	GetResponse(ctx context.Context, key string) (*models.IdempotentResponse, error)
+	Complete(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) (*models.IdempotentResponse, error)) error
+	Release(ctx context.Context, key string) error
+}
+
+// Idempotency is a middleware that makes mutating requests carrying an
+// Idempotency-Key safe to retry. The key is claimed before the request
+// runs, and the first response is stored for ttl and replayed, headers
+// included, for every retry, while a retry whose method, URL or body
+// differs from the original is rejected. Requests sharing a key are
+// serialized: a retry arriving while the original still runs waits for it
+// to complete and replays its response, or takes the key over when the
+// original failed, and is only rejected with 409 when the original is still
+// running after idempotencyWait.
+//
+// The request runs in a transaction that also stores its response, and the
+// response is buffered until that transaction commits, so a change is never
+// committed without the response that lets a retry replay it. Server errors
+// are rolled back and not stored, so a failed request can be retried.
+// Bodies are hashed as they are read, never buffered.
+func Idempotency(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidParameter, "Idempotency-Key must be at most 255 characters"))
+				return
+			}
+
+			stored, err := claimOrWait(r.Context(), store, key)
+			if err != nil {
+				problem.Error(w, r, err)
+				return
+			}
+			if stored != nil {
+				replay(w, r, stored)
+				return
+			}
+
+			fingerprint := newFingerprint(r)
+			r.Body = io.NopCloser(io.TeeReader(r.Body, fingerprint))
+			buf := newResponseBuffer()
+			err = store.Complete(r.Context(), key, ttl, func(ctx context.Context) (*models.IdempotentResponse, error) {
+				next.ServeHTTP(buf, r.WithContext(ctx))
+				if buf.status >= http.StatusInternalServerError {
+					return nil, nil
+				}
+				// The fingerprint covers the whole body, including what the
+				// handler left unread
+				if _, err := io.Copy(io.Discard, r.Body); err != nil {
+					return nil, fmt.Errorf("failed to read request body: %w", err)
+				}
+				return &models.IdempotentResponse{
+					Key:         key,
+					Fingerprint: fingerprint.sum(),
+					StatusCode:  buf.status,
+					Headers:     buf.header.Clone(),
+					Body:        buf.body.Bytes(),
+				}, nil
+			})
+
+			// Nothing was committed when the response is not stored, so the
+			// key is given up for the request to be retried. The request
+			// context may already be done, but the key must still go.
+			if err != nil || buf.status >= http.StatusInternalServerError {
+				if err := store.Release(context.Background(), key); err != nil {
+					log.Printf("request %s: %v", audit.FromContext(r.Context()).RequestID, err)
+				}
+			}
+			if err != nil {
+				problem.Error(w, r, err)
+				return
+			}
+			buf.writeTo(w)
+		})
+	}
+}
+
+// claimOrWait claims key for the request. When the key is held by another
+// request, it waits for that request to complete and returns its stored
+// response, or claims the key once it is released.
+func claimOrWait(ctx context.Context, store IdempotencyStore, key string) (*models.IdempotentResponse, error) {
+	deadline := time.NewTimer(idempotencyWait)
+	defer deadline.Stop()
+	for {
+		claimed, err := store.Claim(ctx, key, idempotencyLease)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		stored, err := store.GetResponse(ctx, key)
+		if err == nil && stored.Completed {
+			return stored, nil
+		}
+		// The key is held by a request still running, or was released
+		// since it was claimed and can be claimed again
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-deadline.C:
+		case <-time.After(idempotencyPollInterval):
+			continue
+		}
+		detail := "A request with this Idempotency-Key is still in progress"
+		return nil, problem.New(http.StatusConflict, problem.CodeIdempotencyKeyInUse, detail)
+	}
+}
+
+// replay answers a request whose idempotency key is held by a completed
+// request with that request's stored response
+func replay(w http.ResponseWriter, r *http.Request, stored *models.IdempotentResponse) {
+	fingerprint := newFingerprint(r)
+	if _, err := io.Copy(fingerprint, r.Body); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRequestBody, "Invalid request body"))
+		return
+	}
+	if stored.Fingerprint != fingerprint.sum() {
+		detail := "Idempotency-Key was already used for a different request"
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, detail))
+		return
+	}
+
+	for name, values := range stored.Headers {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+// isMutating reports whether requests with the method change state
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// fingerprint hashes a request by its method, path, query and body, with
+// the body written to it as it is read
+type fingerprint struct {
+	hash.Hash
+}
+
+// newFingerprint starts the fingerprint of a request from everything but its body
+func newFingerprint(r *http.Request) *fingerprint {
+	f := &fingerprint{Hash: sha256.New()}
+	io.WriteString(f, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	return f
+}
+
+// sum returns the fingerprint of the request as hex
+func (f *fingerprint) sum() string {
+	return hex.EncodeToString(f.Sum(nil))
+}
+
+// responseBuffer holds a response until it is known whether it can be sent
+type responseBuffer struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+// newResponseBuffer creates an empty response buffer
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+// Header returns the headers of the buffered response
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader records the status of the response
+func (b *responseBuffer) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+// Write buffers the body of the response
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+// writeTo sends the buffered response
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	for name, values := range b.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
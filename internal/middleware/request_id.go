@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/audit"
+)
+
+// RequestIDHeader is the header used to propagate the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID is a middleware that assigns every request an ID and records it,
+// along with the client IP, in the request context for the audit log
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		ctx := audit.NewContext(r.Context(), audit.Info{
+			RequestID: requestID,
+			IP:        ip,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEvent represents a single recorded mutation
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	NoteID    *uuid.UUID      `json:"note_id,omitempty"`
+	RequestID string          `json:"request_id"`
+	IP        string          `json:"ip"`
+	Diff      json.RawMessage `json:"diff"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotentResponse is the stored response of a request made with an
+// Idempotency-Key, replayed when the request is retried. Until the request
+// completes, the key is held without a response.
+type IdempotentResponse struct {
+	Key         string      `json:"key"`
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  int         `json:"status_code"`
+	Headers     http.Header `json:"headers"`
+	Body        []byte      `json:"body"`
+	Completed   bool        `json:"completed"`
+	CreatedAt   time.Time   `json:"created_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxMessage is a note change recorded in the same transaction as the
+// change itself, waiting to be handed to the outbox sinks
+type OutboxMessage struct {
+	ID        int64           `json:"id"`
+	EventID   int64           `json:"event_id"`
+	NoteID    uuid.UUID       `json:"note_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -0,0 +1,280 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+// unversionedAliasOf is the API version whose paths are also served without
+// their version prefix, as deprecated aliases
+const unversionedAliasOf = "/v1"
+
+// spec is the parsed OpenAPI document used for request validation
+var spec = mustLoad(specJSON)
+
+// Spec is the subset of an OpenAPI 3.1 document needed for request validation
+type Spec struct {
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Parameters    map[string]*Parameter   `json:"parameters"`
+		RequestBodies map[string]*RequestBody `json:"requestBodies"`
+		Schemas       map[string]*Schema      `json:"schemas"`
+	} `json:"components"`
+}
+
+// PathItem holds the operations available on a single path
+type PathItem struct {
+	Parameters []*Parameter
+	Operations map[string]*Operation
+}
+
+// Operation describes a single API operation on a path
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+// Parameter describes a single operation parameter
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the body accepted by an operation
+type RequestBody struct {
+	Ref      string                `json:"$ref"`
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// MediaType holds the schema for a single content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema supported by the validator
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 SchemaType         `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+}
+
+// SchemaType is a JSON Schema type, which may be a single name or a list of names
+type SchemaType []string
+
+// UnmarshalJSON accepts both "string" and ["string", "null"] forms
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// nullable reports whether null is one of the allowed types
+func (t SchemaType) nullable() bool {
+	for _, name := range t {
+		if name == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// primary returns the first allowed type other than null
+func (t SchemaType) primary() string {
+	for _, name := range t {
+		if name != "null" {
+			return name
+		}
+	}
+	return ""
+}
+
+// httpMethods are the path item keys that hold operations
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// UnmarshalJSON splits a path item into its shared parameters and its operations
+func (p *PathItem) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if params, ok := raw["parameters"]; ok {
+		if err := json.Unmarshal(params, &p.Parameters); err != nil {
+			return err
+		}
+	}
+
+	p.Operations = make(map[string]*Operation)
+	for _, method := range httpMethods {
+		if op, ok := raw[method]; ok {
+			var operation Operation
+			if err := json.Unmarshal(op, &operation); err != nil {
+				return fmt.Errorf("%s: %w", method, err)
+			}
+			p.Operations[strings.ToUpper(method)] = &operation
+		}
+	}
+	return nil
+}
+
+// Load parses an OpenAPI document and checks that all its references resolve
+func Load(data []byte) (*Spec, error) {
+	var s Spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	for path, item := range s.Paths {
+		for method := range item.Operations {
+			if _, _, err := s.lookup(path, method); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// mustLoad parses the embedded document, which is known at compile time
+func mustLoad(data []byte) *Spec {
+	s, err := Load(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// HasOperation reports whether the embedded document describes the given
+// mux path template and HTTP method
+func HasOperation(path, method string) bool {
+	op, _, err := spec.lookup(path, method)
+	return err == nil && op != nil
+}
+
+// lookup finds the operation for a path template and method, along with its
+// resolved parameters and request body
+func (s *Spec) lookup(path, method string) (*Operation, []*Parameter, error) {
+	item, ok := s.Paths[path]
+	if !ok {
+		item, ok = s.Paths[unversionedAliasOf+path]
+	}
+	if !ok {
+		return nil, nil, nil
+	}
+	op, ok := item.Operations[strings.ToUpper(method)]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	// Operation-level parameters override path-level ones with the same name and location
+	var params []*Parameter
+	seen := make(map[string]bool)
+	for _, group := range [][]*Parameter{op.Parameters, item.Parameters} {
+		for _, param := range group {
+			resolved, err := s.parameter(param)
+			if err != nil {
+				return nil, nil, err
+			}
+			key := resolved.In + ":" + resolved.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, err := s.schema(resolved.Schema); err != nil {
+				return nil, nil, err
+			}
+			params = append(params, resolved)
+		}
+	}
+
+	if op.RequestBody != nil {
+		body, err := s.requestBody(op.RequestBody)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, media := range body.Content {
+			if err := s.checkSchema(media.Schema); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return op, params, nil
+}
+
+// parameter resolves a parameter reference
+func (s *Spec) parameter(p *Parameter) (*Parameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/")
+	if !ok || s.Components.Parameters[name] == nil {
+		return nil, fmt.Errorf("unresolved parameter reference %q", p.Ref)
+	}
+	return s.Components.Parameters[name], nil
+}
+
+// requestBody resolves a request body reference
+func (s *Spec) requestBody(b *RequestBody) (*RequestBody, error) {
+	if b.Ref == "" {
+		return b, nil
+	}
+	name, ok := strings.CutPrefix(b.Ref, "#/components/requestBodies/")
+	if !ok || s.Components.RequestBodies[name] == nil {
+		return nil, fmt.Errorf("unresolved request body reference %q", b.Ref)
+	}
+	return s.Components.RequestBodies[name], nil
+}
+
+// schema resolves a schema reference
+func (s *Spec) schema(schema *Schema) (*Schema, error) {
+	if schema == nil || schema.Ref == "" {
+		return schema, nil
+	}
+	name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+	if !ok || s.Components.Schemas[name] == nil {
+		return nil, fmt.Errorf("unresolved schema reference %q", schema.Ref)
+	}
+	return s.Components.Schemas[name], nil
+}
+
+// checkSchema resolves every reference reachable from a schema
+func (s *Spec) checkSchema(schema *Schema) error {
+	resolved, err := s.schema(schema)
+	if err != nil || resolved == nil {
+		return err
+	}
+	for _, property := range resolved.Properties {
+		if err := s.checkSchema(property); err != nil {
+			return err
+		}
+	}
+	return s.checkSchema(resolved.Items)
+}
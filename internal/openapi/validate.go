@@ -0,0 +1,338 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/problem"
+)
+
+// maxBodySize is the largest request body the validator will read
+const maxBodySize = 1 << 20
+
+// Validator is a middleware that validates the parameters and body of every
+// request against the operation the matched route maps to in the spec.
+// Routes the spec does not describe are passed through untouched.
+func Validator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		op, params, err := spec.lookup(path, r.Method)
+		if err != nil || op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		errs := validateParameters(r, params)
+
+		if op.RequestBody != nil && !streamedBody(r, op.RequestBody) {
+			body, p, bodyErrs := validateBody(w, r, op.RequestBody)
+			if p != nil {
+				problem.Write(w, r, p)
+				return
+			}
+			errs = append(errs, bodyErrs...)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateParameters checks the path, query and header parameters of a request
+func validateParameters(r *http.Request, params []*Parameter) []database.FieldError {
+	var errs []database.FieldError
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	for _, param := range params {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value, present = vars[param.Name]
+		case "query":
+			present = query.Has(param.Name)
+			value = query.Get(param.Name)
+		case "header":
+			value = r.Header.Get(param.Name)
+			present = value != ""
+		default:
+			continue
+		}
+
+		location := param.In + "." + param.Name
+		if !present {
+			if param.Required {
+				errs = append(errs, database.FieldError{Field: location, Message: "is required"})
+			}
+			continue
+		}
+
+		schema, _ := spec.schema(param.Schema)
+		if schema == nil {
+			continue
+		}
+		coerced, err := coerceParameter(schema, value)
+		if err != nil {
+			errs = append(errs, database.FieldError{Field: location, Message: err.Error()})
+			continue
+		}
+		errs = append(errs, validateValue(schema, coerced, location)...)
+	}
+
+	return errs
+}
+
+// coerceParameter converts a raw parameter string to the type its schema expects
+func coerceParameter(schema *Schema, value string) (any, error) {
+	switch schema.Type.primary() {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return json.Number(value), nil
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return json.Number(value), nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	default:
+		return value, nil
+	}
+}
+
+// validateBody reads and checks the request body. It returns the raw body so
+// it can be handed on to the handler, and a problem when the body cannot be
+// validated at all.
+func validateBody(w http.ResponseWriter, r *http.Request, requestBody *RequestBody) ([]byte, *problem.Problem, []database.FieldError) {
+	requestBody, _ = spec.requestBody(requestBody)
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return nil, problem.New(http.StatusRequestEntityTooLarge, problem.CodeRequestTooLarge, "The request body is too large"), nil
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if requestBody.Required {
+			return body, nil, []database.FieldError{{Field: "body", Message: "is required"}}
+		}
+		return body, nil, nil
+	}
+
+	media, ok := mediaTypeFor(r, requestBody)
+	if !ok {
+		detail := "Content-Type must be one of " + strings.Join(supportedMediaTypes(requestBody), ", ")
+		return nil, problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, detail), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return body, nil, []database.FieldError{{Field: "body", Message: "must be valid JSON"}}
+	}
+
+	schema, _ := spec.schema(media.Schema)
+	if schema == nil {
+		return body, nil, nil
+	}
+	return body, nil, validateValue(schema, value, "body")
+}
+
+// streamedBody reports whether a request body is in a media type the spec
+// accepts but the validator does not parse, such as NDJSON. Such bodies may
+// be far larger than maxBodySize and are left for the handler to stream.
+func streamedBody(r *http.Request, requestBody *RequestBody) bool {
+	requestBody, _ = spec.requestBody(requestBody)
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	if _, ok := requestBody.Content[mediaType]; !ok {
+		return false
+	}
+	return mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")
+}
+
+// mediaTypeFor picks the media type matching the request's Content-Type.
+// Requests without a Content-Type are treated as JSON.
+func mediaTypeFor(r *http.Request, requestBody *RequestBody) (*MediaType, bool) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	media, ok := requestBody.Content[mediaType]
+	return media, ok
+}
+
+// supportedMediaTypes lists the content types a request body may use
+func supportedMediaTypes(requestBody *RequestBody) []string {
+	var types []string
+	for mediaType := range requestBody.Content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// validateValue checks a decoded JSON value against a schema
+func validateValue(schema *Schema, value any, location string) []database.FieldError {
+	schema, err := spec.schema(schema)
+	if err != nil || schema == nil {
+		return nil
+	}
+
+	invalid := func(format string, args ...any) []database.FieldError {
+		return []database.FieldError{{Field: location, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if value == nil && schema.Type.nullable() {
+		return nil
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		return invalid("must be one of %v", schema.Enum)
+	}
+
+	kind := schema.Type.primary()
+	switch kind {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return invalid("must be an object")
+		}
+		var errs []database.FieldError
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				errs = append(errs, database.FieldError{Field: location + "." + name, Message: "is required"})
+			}
+		}
+		for name, property := range object {
+			propertySchema, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					errs = append(errs, database.FieldError{Field: location + "." + name, Message: "is not allowed"})
+				}
+				continue
+			}
+			errs = append(errs, validateValue(propertySchema, property, location+"."+name)...)
+		}
+		return errs
+
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return invalid("must be an array")
+		}
+		var errs []database.FieldError
+		if schema.Items != nil {
+			for i, item := range array {
+				errs = append(errs, validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", location, i))...)
+			}
+		}
+		return errs
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return invalid("must be a string")
+		}
+		length := utf8.RuneCountInString(s)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			if *schema.MinLength == 1 {
+				return invalid("must not be empty")
+			}
+			return invalid("must be at least %d characters", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			return invalid("must be at most %d characters", *schema.MaxLength)
+		}
+		switch schema.Format {
+		case "uuid":
+			if _, err := uuid.Parse(s); err != nil {
+				return invalid("must be a UUID")
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return invalid("must be an RFC 3339 date-time")
+			}
+		}
+
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return invalid("must be a %s", kind)
+		}
+		if kind == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return invalid("must be an integer")
+			}
+		}
+		f, _ := n.Float64()
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return invalid("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			return invalid("must be at most %v", *schema.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return invalid("must be a boolean")
+		}
+	}
+
+	return nil
+}
+
+// inEnum reports whether value is one of the allowed enum values
+func inEnum(enum []any, value any) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+		if n, ok := value.(json.Number); ok {
+			if f, err := n.Float64(); err == nil && reflect.DeepEqual(allowed, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+const (
+	// pollInterval is how often the dispatcher looks for pending messages
+	// when the outbox has been drained
+	pollInterval = time.Second
+	// batchSize is how many messages are claimed at once
+	batchSize = 100
+	// retention is how long dispatched messages are kept before being purged
+	retention = 24 * time.Hour
+	// purgeInterval is how often dispatched messages are purged
+	purgeInterval = time.Hour
+	// The bounds of the delay before a failed message is retried
+	backoffBase = time.Second
+	backoffCap  = 5 * time.Minute
+)
+
+// Sink receives the messages of the outbox. Delivery is at least once, so
+// a sink may see a message again and must handle it idempotently.
+type Sink interface {
+	Deliver(ctx context.Context, msg *models.OutboxMessage) error
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(ctx context.Context, msg *models.OutboxMessage) error
+
+// Deliver calls f
+func (f SinkFunc) Deliver(ctx context.Context, msg *models.OutboxMessage) error {
+	return f(ctx, msg)
+}
+
+// Store is the storage the dispatcher claims messages from
+type Store interface {
+	Dispatch(ctx context.Context, limit int, deliver func(ctx context.Context, msg *models.OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error)
+	PurgeDispatched(ctx context.Context, before time.Time) error
+}
+
+// Dispatcher hands the messages of the outbox to its sinks. Several
+// dispatchers may share a store, as each claims its own messages.
+type Dispatcher struct {
+	store Store
+	sinks []Sink
+}
+
+// NewDispatcher creates a dispatcher delivering every message to each of sinks, in order
+func NewDispatcher(store Store, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+		sinks: sinks,
+	}
+}
+
+// Run dispatches pending messages until ctx is done. A full batch is
+// followed by another straight away, so a backlog drains without waiting.
+func (d *Dispatcher) Run(ctx context.Context) {
+	lastPurge := time.Now()
+	for {
+		claimed, err := d.DispatchPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox dispatcher: %v", err)
+		}
+
+		if time.Since(lastPurge) > purgeInterval {
+			if err := d.store.PurgeDispatched(ctx, time.Now().Add(-retention)); err != nil && ctx.Err() == nil {
+				log.Printf("outbox dispatcher: %v", err)
+			}
+			lastPurge = time.Now()
+		}
+
+		wait := pollInterval
+		if err == nil && claimed == batchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// DispatchPending delivers the messages that are due and returns how many were claimed
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	return d.store.Dispatch(ctx, batchSize, d.deliver, Backoff)
+}
+
+// deliver hands a message to every sink, stopping at the first failure.
+// The whole message is retried, including the sinks that succeeded.
+func (d *Dispatcher) deliver(ctx context.Context, msg *models.OutboxMessage) error {
+	for i, sink := range d.sinks {
+		if err := sink.Deliver(ctx, msg); err != nil {
+			log.Printf("outbox dispatcher: message %d: sink %d: %v", msg.ID, i, err)
+			return fmt.Errorf("sink %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Backoff is the delay before retrying a message after the given number of
+// attempts. It doubles with every attempt up to a cap.
+func Backoff(attempts int) time.Duration {
+	delay := backoffBase
+	for i := 1; i < attempts && delay < backoffCap; i++ {
+		delay *= 2
+	}
+	return min(delay, backoffCap)
+}
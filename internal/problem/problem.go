@@ -0,0 +1,121 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/database"
+)
+
+// ContentType is the media type of RFC 7807 problem details
+const ContentType = "application/problem+json"
+
+// Stable error codes clients can rely on
+const (
+	CodeInvalidRequestBody   = "invalid_request_body"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeValidationFailed     = "validation_failed"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeInvalidPatch         = "invalid_patch"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodeBatchAborted         = "batch_aborted"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeIdempotencyKeyInUse  = "idempotency_key_in_use"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeRequestTooLarge      = "request_too_large"
+	CodeWebhookInactive      = "webhook_inactive"
+	CodeInternal             = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details object extended with a stable
+// error code, the request ID and field-level validation errors
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []database.FieldError `json:"errors,omitempty"`
+}
+
+// New creates a problem for the given status, code and client-facing detail
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Validation creates a validation problem listing the invalid fields
+func Validation(fields []database.FieldError) *Problem {
+	p := New(http.StatusBadRequest, CodeValidationFailed, "The request contains invalid fields")
+	p.Errors = fields
+	return p
+}
+
+// Error implements the error interface so a problem can be returned as an error
+func (p *Problem) Error() string {
+	return p.Code + ": " + p.Detail
+}
+
+// Write sends a problem as the response
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	p.Instance = r.URL.Path
+	p.RequestID = audit.FromContext(r.Context()).RequestID
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// NotFound reports that no route matches the request path
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(http.StatusNotFound, CodeNotFound, "The requested resource was not found"))
+}
+
+// MethodNotAllowed reports that the request path exists but not for the
+// request method. The caller sets the Allow header.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, fmt.Sprintf("%s is not allowed on this resource", r.Method)))
+}
+
+// Error sends the problem matching a domain error. Errors that are not part
+// of the domain are logged with the request ID and reported as a generic
+// internal error so their details never reach the client.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	Write(w, r, FromError(r, err))
+}
+
+// FromError maps an error to the problem describing it to clients
+func FromError(r *http.Request, err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	var validationErr *database.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return Validation(validationErr.Fields)
+	case errors.Is(err, database.ErrNotFound):
+		return New(http.StatusNotFound, CodeNotFound, "The requested resource was not found")
+	case errors.Is(err, database.ErrConflict):
+		return New(http.StatusConflict, CodeConflict, "The request conflicts with the current state of the resource")
+	case errors.Is(err, database.ErrBatchAborted):
+		return New(http.StatusFailedDependency, CodeBatchAborted, "Not applied because another operation in the atomic batch failed")
+	}
+
+	database.Internal(r.Context(), fmt.Errorf("%s %s: %w", r.Method, r.URL.Path, err))
+	return New(http.StatusInternalServerError, CodeInternal, "An internal error occurred")
+}
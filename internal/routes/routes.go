@@ -1,38 +1,90 @@
 package routes
 
 import (
+	"net/http"
+	"strings"
+
 	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/config"
 	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/events"
 	"github.com/moabdelazem/noter/internal/handlers"
 	"github.com/moabdelazem/noter/internal/middleware"
+	"github.com/moabdelazem/noter/internal/openapi"
+	"github.com/moabdelazem/noter/internal/problem"
 )
 
+// allMethods are the methods checked when listing what a path allows
+var allMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
 // SetupRoutes configures all routes for the application
 func SetupRoutes(router *mux.Router) {
 	// Add middleware
+	router.Use(middleware.RequestID)
 	router.Use(middleware.Logger)
 
+	// Unmatched requests skip the router's middleware, so their handler
+	// adds the request ID and logging itself
+	unmatched := middleware.RequestID(middleware.Logger(unmatchedHandler(router)))
+	router.NotFoundHandler = unmatched
+	router.MethodNotAllowedHandler = unmatched
+
 	// Home route
 	router.HandleFunc("/", handlers.HomeHandler).Methods("GET")
 
 	// Health check route
 	router.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
+
+	// API documentation routes
+	router.HandleFunc("/openapi.json", openapi.SpecHandler).Methods("GET")
+	router.HandleFunc("/docs", openapi.DocsHandler).Methods("GET")
 }
 
 // SetupDBRoutes configures routes that require a database connection
-func SetupDBRoutes(router *mux.Router, db *database.DB) {
+func SetupDBRoutes(router *mux.Router, db *database.DB, cfg *config.Config, broker *events.Broker) {
 	// Database health check route
 	router.HandleFunc("/db/health", handlers.DBHealthHandler(db)).Methods("GET")
 
-	// Create note repository
-	noteRepo := database.NewNoteRepository(db)
+	// Create the dependencies shared by every API version
+	deps := apiDeps{
+		noteRepo:           database.NewNoteRepository(db),
+		auditRepo:          database.NewAuditRepository(db),
+		webhookRepo:        database.NewWebhookRepository(db),
+		broker:             broker,
+		idempotency:        middleware.Idempotency(database.NewIdempotencyRepository(db), cfg.IdempotencyTTL),
+		maxBatchOperations: cfg.MaxBatchOperations,
+		webhookNetworks:    cfg.WebhookAllowedNetworks,
+	}
+
+	// Versioned API routes
+	setupAPIRoutes(router.PathPrefix(v1.prefix).Subrouter(), v1, deps)
+
+	// Unversioned aliases of the routes that predate versioning, kept for
+	// existing integrations
+	setupLegacyRoutes(router, deps)
+}
 
-	// Create note handler
-	noteHandler := handlers.NewNoteHandler(noteRepo)
+// unmatchedHandler reports a problem for a request no route matches: 405
+// with the supported methods in Allow when the path exists for other
+// methods, 404 otherwise. The methods are probed rather than taken from
+// the router's match error, which subrouters do not always preserve.
+func unmatchedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range allMethods {
+			var match mux.RouteMatch
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			if router.Match(probe, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
 
-	// Note routes
-	notesRouter := router.PathPrefix("/notes").Subrouter()
-	notesRouter.HandleFunc("", noteHandler.GetAllNotes).Methods("GET")      // GET /notes - get all notes
-	notesRouter.HandleFunc("", noteHandler.CreateNote).Methods("POST")      // POST /notes - create a new note
-	notesRouter.HandleFunc("/{id}", noteHandler.GetNoteByID).Methods("GET") // GET /notes/{id} - get a note by ID
+		if len(allowed) == 0 {
+			problem.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		problem.MethodNotAllowed(w, r)
+	})
 }
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/events"
+	"github.com/moabdelazem/noter/internal/graph"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/middleware"
+	"github.com/moabdelazem/noter/internal/openapi"
+)
+
+// apiVersion describes one mounted version of the API. Versions share the
+// handlers and differ in the presenter shaping their responses.
+type apiVersion struct {
+	prefix    string
+	presenter handlers.Presenter
+}
+
+// v1 is the current version of the API
+var v1 = apiVersion{prefix: "/v1", presenter: handlers.V1Presenter{}}
+
+// The unversioned routes are deprecated aliases of v1 and are removed at sunset
+var (
+	unversionedDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	unversionedSunset       = time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+)
+
+// apiDeps holds the dependencies shared by every API version
+type apiDeps struct {
+	noteRepo    *database.NoteRepository
+	auditRepo   *database.AuditRepository
+	webhookRepo *database.WebhookRepository
+	broker      *events.Broker
+	idempotency func(http.Handler) http.Handler
+	// maxBatchOperations is the largest number of operations a batch may contain
+	maxBatchOperations int
+	// webhookNetworks are the non-public networks webhooks may be registered for
+	webhookNetworks []netip.Prefix
+}
+
+// setupLegacyRoutes registers the deprecated unversioned aliases of the v1
+// note routes that were served before the API was versioned. Routes added
+// since then only exist under a version.
+func setupLegacyRoutes(router *mux.Router, deps apiDeps) {
+	// The deprecation headers are added first so every response carries them
+	legacyRouter := router.PathPrefix("/notes").Subrouter()
+	legacyRouter.Use(middleware.Deprecated(unversionedDeprecatedAt, unversionedSunset, v1.prefix))
+	legacyRouter.Use(openapi.Validator)
+	legacyRouter.Use(deps.idempotency)
+
+	noteHandler := handlers.NewNoteHandler(deps.noteRepo, v1.presenter, deps.maxBatchOperations)
+	legacyRouter.HandleFunc("", noteHandler.GetAllNotes).Methods("GET")      // GET /notes - get all notes
+	legacyRouter.HandleFunc("", noteHandler.CreateNote).Methods("POST")      // POST /notes - create a new note
+	legacyRouter.HandleFunc("/{id}", noteHandler.GetNoteByID).Methods("GET") // GET /notes/{id} - get a note by ID
+}
+
+// setupAPIRoutes registers the routes of an API version on router
+func setupAPIRoutes(router *mux.Router, version apiVersion, deps apiDeps) {
+	// Validate requests against the OpenAPI spec, then make mutating requests
+	// safe to retry with an Idempotency-Key
+	router.Use(openapi.Validator)
+	router.Use(deps.idempotency)
+
+	// Create note and event handlers
+	noteHandler := handlers.NewNoteHandler(deps.noteRepo, version.presenter, deps.maxBatchOperations)
+	eventHandler := handlers.NewEventHandler(deps.broker)
+
+	// Note routes
+	notesRouter := router.PathPrefix("/notes").Subrouter()
+	notesRouter.HandleFunc("", noteHandler.GetAllNotes).Methods("GET")      // GET /notes - get all notes
+	notesRouter.HandleFunc("", noteHandler.CreateNote).Methods("POST")      // POST /notes - create a new note
+	notesRouter.HandleFunc("/batch", noteHandler.Batch).Methods("POST")     // POST /notes/batch - create, update and delete notes in one request
+	notesRouter.HandleFunc("/events", eventHandler.Stream).Methods("GET")   // GET /notes/events - follow note changes as Server-Sent Events
+	notesRouter.HandleFunc("/{id}", noteHandler.GetNoteByID).Methods("GET") // GET /notes/{id} - get a note by ID
+	notesRouter.HandleFunc("/{id}", noteHandler.PatchNote).Methods("PATCH") // PATCH /notes/{id} - partially update a note
+
+	// Create audit handler
+	auditHandler := handlers.NewAuditHandler(deps.auditRepo)
+
+	// Audit routes
+	auditRouter := router.PathPrefix("/audit").Subrouter()
+	auditRouter.HandleFunc("", auditHandler.ListEvents).Methods("GET")          // GET /audit - query the audit log
+	auditRouter.HandleFunc("/export", auditHandler.ExportEvents).Methods("GET") // GET /audit/export - export the audit log as NDJSON
+
+	// Create export and import handlers
+	exportHandler := handlers.NewExportHandler(deps.noteRepo)
+	importHandler := handlers.NewImportHandler(deps.noteRepo)
+
+	// Export and import routes
+	router.HandleFunc("/export/markdown", exportHandler.ExportMarkdown).Methods("GET") // GET /export/markdown - export the notes as a zip of Markdown files
+	router.HandleFunc("/export.ndjson", exportHandler.ExportNDJSON).Methods("GET")     // GET /export.ndjson - export the notes as NDJSON
+	router.HandleFunc("/import.ndjson", importHandler.ImportNDJSON).Methods("POST")    // POST /import.ndjson - import notes in bulk from NDJSON
+
+	// Create webhook handler
+	webhookHandler := handlers.NewWebhookHandler(deps.webhookRepo, deps.webhookNetworks)
+
+	// Webhook routes
+	webhooksRouter := router.PathPrefix("/webhooks").Subrouter()
+	webhooksRouter.HandleFunc("", webhookHandler.ListWebhooks).Methods("GET")                                      // GET /webhooks - get all webhooks
+	webhooksRouter.HandleFunc("", webhookHandler.CreateWebhook).Methods("POST")                                    // POST /webhooks - subscribe a URL to note events
+	webhooksRouter.HandleFunc("/{id}", webhookHandler.GetWebhook).Methods("GET")                                   // GET /webhooks/{id} - get a webhook by ID
+	webhooksRouter.HandleFunc("/{id}", webhookHandler.UpdateWebhook).Methods("PATCH")                              // PATCH /webhooks/{id} - update or re-enable a webhook
+	webhooksRouter.HandleFunc("/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")                             // DELETE /webhooks/{id} - delete a webhook
+	webhooksRouter.HandleFunc("/{id}/deliveries", webhookHandler.ListDeliveries).Methods("GET")                    // GET /webhooks/{id}/deliveries - get the latest deliveries of a webhook
+	webhooksRouter.HandleFunc("/{id}/deliveries/{deliveryID}/redeliver", webhookHandler.Redeliver).Methods("POST") // POST /webhooks/{id}/deliveries/{deliveryID}/redeliver - send a delivery again
+
+	// GraphQL route
+	graphHandler := graph.NewHandler(deps.noteRepo, deps.auditRepo)
+	router.Handle("/graphql", graphHandler).Methods("POST") // POST /graphql - run a GraphQL query or mutation
+}
@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/database"
+	noterv1 "github.com/moabdelazem/noter/internal/gen/noter/v1"
+	"github.com/moabdelazem/noter/internal/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// listPageSize is the number of notes fetched per query while streaming
+const listPageSize = 100
+
+// NoteStore is the subset of database.NoteRepository used by the service
+type NoteStore interface {
+	CreateNote(ctx context.Context, note *models.Note) error
+	ListNotes(ctx context.Context, filter database.NoteFilter) ([]*models.Note, error)
+	GetNoteByID(ctx context.Context, id uuid.UUID) (*models.Note, error)
+	UpdateNote(ctx context.Context, id uuid.UUID, fn func(*models.Note) error) (*models.Note, error)
+	DeleteNote(ctx context.Context, id uuid.UUID) error
+}
+
+// NoteService implements the noter.v1.NoteService gRPC service
+type NoteService struct {
+	noterv1.UnimplementedNoteServiceServer
+	notes NoteStore
+}
+
+// NewNoteService creates a new note service
+func NewNoteService(notes NoteStore) *NoteService {
+	return &NoteService{
+		notes: notes,
+	}
+}
+
+// CreateNote creates a new note
+func (s *NoteService) CreateNote(ctx context.Context, req *noterv1.CreateNoteRequest) (*noterv1.CreateNoteResponse, error) {
+	if err := validateTitle(req.GetTitle()); err != nil {
+		return nil, err
+	}
+
+	note := models.NewNote(req.GetTitle())
+	if err := s.notes.CreateNote(ctx, note); err != nil {
+		return nil, noteError(ctx, err)
+	}
+	return &noterv1.CreateNoteResponse{Note: toProto(note)}, nil
+}
+
+// GetNote returns a single note by ID
+func (s *NoteService) GetNote(ctx context.Context, req *noterv1.GetNoteRequest) (*noterv1.GetNoteResponse, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := s.notes.GetNoteByID(ctx, id)
+	if err != nil {
+		return nil, noteError(ctx, err)
+	}
+	return &noterv1.GetNoteResponse{Note: toProto(note)}, nil
+}
+
+// ListNotes streams the notes matching the filter, fetching them page by page
+func (s *NoteService) ListNotes(req *noterv1.ListNotesRequest, stream grpc.ServerStreamingServer[noterv1.ListNotesResponse]) error {
+	filter := database.NoteFilter{
+		TitleContains: req.GetTitleContains(),
+		Limit:         listPageSize,
+	}
+	if req.GetCreatedAfter() != nil {
+		filter.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+	if req.GetCreatedBefore() != nil {
+		filter.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+
+	for {
+		page, err := s.notes.ListNotes(stream.Context(), filter)
+		if err != nil {
+			return internalError(stream.Context(), err)
+		}
+		for _, note := range page {
+			if err := stream.Send(&noterv1.ListNotesResponse{Note: toProto(note)}); err != nil {
+				return err
+			}
+		}
+		if len(page) < listPageSize {
+			return nil
+		}
+
+		last := page[len(page)-1]
+		filter.After = &database.NoteCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
+
+// UpdateNote changes the title of a note
+func (s *NoteService) UpdateNote(ctx context.Context, req *noterv1.UpdateNoteRequest) (*noterv1.UpdateNoteResponse, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTitle(req.GetTitle()); err != nil {
+		return nil, err
+	}
+
+	note, err := s.notes.UpdateNote(ctx, id, func(note *models.Note) error {
+		note.Title = req.GetTitle()
+		return nil
+	})
+	if err != nil {
+		return nil, noteError(ctx, err)
+	}
+	return &noterv1.UpdateNoteResponse{Note: toProto(note)}, nil
+}
+
+// DeleteNote removes a note
+func (s *NoteService) DeleteNote(ctx context.Context, req *noterv1.DeleteNoteRequest) (*noterv1.DeleteNoteResponse, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.notes.DeleteNote(ctx, id); err != nil {
+		return nil, noteError(ctx, err)
+	}
+	return &noterv1.DeleteNoteResponse{}, nil
+}
+
+// toProto converts a note to its protobuf representation
+func toProto(note *models.Note) *noterv1.Note {
+	return &noterv1.Note{
+		Id:        note.ID.String(),
+		Title:     note.Title,
+		CreatedAt: timestamppb.New(note.CreatedAt),
+		UpdatedAt: timestamppb.New(note.UpdatedAt),
+	}
+}
+
+// parseID parses a note ID field
+func parseID(value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid note ID")
+	}
+	return id, nil
+}
+
+// validateTitle checks a title with the rules shared by every API
+func validateTitle(title string) error {
+	if fieldErrors := database.ValidateTitle(title); len(fieldErrors) > 0 {
+		return status.Error(codes.InvalidArgument, (&database.ValidationError{Fields: fieldErrors}).Error())
+	}
+	return nil
+}
+
+// noteError maps repository errors for a single note to gRPC status errors
+func noteError(ctx context.Context, err error) error {
+	var validationErr *database.ValidationError
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return status.Error(codes.NotFound, "note not found")
+	case errors.Is(err, database.ErrConflict):
+		return status.Error(codes.AlreadyExists, "note already exists")
+	case errors.As(err, &validationErr):
+		return status.Error(codes.InvalidArgument, validationErr.Error())
+	}
+	return internalError(ctx, err)
+}
+
+// internalError reports an error that is not part of the domain as a
+// generic status
+func internalError(ctx context.Context, err error) error {
+	return status.Error(codes.Internal, database.Internal(ctx, err).Error())
+}
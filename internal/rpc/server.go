@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/audit"
+	noterv1 "github.com/moabdelazem/noter/internal/gen/noter/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+)
+
+// requestIDKey is the metadata key used to propagate the request ID
+const requestIDKey = "x-request-id"
+
+// NewServer creates a gRPC server exposing the note service along with the
+// standard health checking and reflection services
+func NewServer(notes NoteStore) (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(requestInfoInterceptor),
+		grpc.StreamInterceptor(streamRequestInfoInterceptor),
+	)
+
+	noterv1.RegisterNoteServiceServer(server, NewNoteService(notes))
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(noterv1.NoteService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+
+	return server, healthServer
+}
+
+// requestInfoInterceptor records the request ID and peer address in the
+// context for the audit log, like the HTTP RequestID middleware does
+func requestInfoInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(withRequestInfo(ctx), req)
+}
+
+// streamRequestInfoInterceptor is requestInfoInterceptor for streaming RPCs
+func streamRequestInfoInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &requestInfoStream{ServerStream: stream, ctx: withRequestInfo(stream.Context())})
+}
+
+// requestInfoStream is a server stream whose context carries the request info
+type requestInfoStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context carrying the request info
+func (s *requestInfoStream) Context() context.Context {
+	return s.ctx
+}
+
+// withRequestInfo returns a copy of ctx carrying the request ID sent by the
+// client, or a new one, and the peer address. The request ID is sent back
+// in the response headers.
+func withRequestInfo(ctx context.Context) context.Context {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 && len(values[0]) <= 64 {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+
+	var ip string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	return audit.NewContext(ctx, audit.Info{RequestID: requestID, IP: ip})
+}
@@ -2,24 +2,39 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/moabdelazem/noter/internal/config"
 	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/events"
+	"github.com/moabdelazem/noter/internal/outbox"
 	"github.com/moabdelazem/noter/internal/routes"
+	"github.com/moabdelazem/noter/internal/rpc"
+	"github.com/moabdelazem/noter/internal/webhooks"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 )
 
+// idempotencyPurgeInterval is how often expired idempotency keys are deleted
+const idempotencyPurgeInterval = 10 * time.Minute
+
 type Server struct {
-	router *mux.Router
-	config *config.Config
-	db     *database.DB
+	router     *mux.Router
+	config     *config.Config
+	db         *database.DB
+	grpcServer *grpc.Server
+	grpcHealth *health.Server
+	events     *events.Broker
 }
 
 func New(cfg *config.Config) *Server {
@@ -31,6 +46,7 @@ func New(cfg *config.Config) *Server {
 	return &Server{
 		router: router,
 		config: cfg,
+		events: events.NewBroker(cfg.EventsReplaySize),
 	}
 }
 
@@ -49,11 +65,16 @@ func (s *Server) InitDB() error {
 	}
 
 	// Setup database-specific routes
-	routes.SetupDBRoutes(s.router, s.db)
+	routes.SetupDBRoutes(s.router, s.db, s.config, s.events)
+
+	// Setup the gRPC services, which also need the database
+	s.grpcServer, s.grpcHealth = rpc.NewServer(database.NewNoteRepository(s.db))
 
 	return nil
 }
 
+// Start serves the HTTP and gRPC APIs until SIGINT or SIGTERM, then shuts
+// them down gracefully. It returns nil once a shutdown has completed.
 func (s *Server) Start() error {
 	// Initialize database connection
 	if err := s.InitDB(); err != nil {
@@ -68,15 +89,73 @@ func (s *Server) Start() error {
 		Handler: s.router,
 	}
 
+	// Start listening for gRPC first, so nothing else is started when the port is taken
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%s", s.config.GRPCPort))
+	if err != nil {
+		return fmt.Errorf("error listening on gRPC port: %w", err)
+	}
+
+	// Background goroutines, waited for before the database is closed
+	var background sync.WaitGroup
+	goBackground := func(fn func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			fn()
+		}()
+	}
+
+	// Follow note changes published by every replica. The event streams end
+	// as soon as the HTTP server starts shutting down, as they never go idle.
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	defer stopEvents()
+	server.RegisterOnShutdown(stopEvents)
+	goBackground(func() {
+		s.events.Run(eventsCtx, func(ctx context.Context, fn func(payload string)) error {
+			return s.db.Listen(ctx, database.NoteEventsChannel, fn)
+		})
+	})
+
+	// Dispatch the outbox and deliver webhooks until the APIs have stopped
+	webhookRepo := database.NewWebhookRepository(s.db)
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	goBackground(func() {
+		outbox.NewDispatcher(database.NewOutboxRepository(s.db), webhooks.NewSink(webhookRepo)).Run(workersCtx)
+	})
+	goBackground(func() {
+		webhooks.NewWorker(webhookRepo, s.config.WebhookAllowedNetworks).Run(workersCtx)
+	})
+	goBackground(func() {
+		purgeIdempotencyKeys(workersCtx, database.NewIdempotencyRepository(s.db))
+	})
+
+	// Start the gRPC server on its own port
+	goBackground(func() {
+		log.Printf("Starting the gRPC server at port %s\n", s.config.GRPCPort)
+		if err := s.grpcServer.Serve(grpcListener); err != nil {
+			log.Printf("gRPC server stopped: %v\n", err)
+		}
+	})
+
 	// Graceful Shutdown
-	// Start a goroutine to handle graceful shutdown
+	// Start a goroutine to handle graceful shutdown, on a signal or when the
+	// HTTP server fails to start
+	serveFailed := make(chan struct{})
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
+
 		// Create a buffered channel to receive OS signals
 		quitChan := make(chan os.Signal, 1)
 		// Listen for SIGTERM and SIGINT signals and send them to quitChan
 		signal.Notify(quitChan, syscall.SIGTERM, syscall.SIGINT)
+		defer signal.Stop(quitChan)
 		// Block until a signal is received
-		<-quitChan
+		select {
+		case <-quitChan:
+		case <-serveFailed:
+		}
 
 		log.Println("Shutting down server...")
 
@@ -85,13 +164,65 @@ func (s *Server) Start() error {
 		// Ensure the cancel function is called to release resources
 		defer cancel()
 
+		// Report NOT_SERVING so gRPC clients stop sending new requests
+		s.grpcHealth.Shutdown()
+
 		// Attempt to gracefully shutdown the server
 		if err := server.Shutdown(ctx); err != nil {
 			// Log error if shutdown fails and server is forced to stop
 			log.Printf("Server forced to shutdown: %v\n", err)
 		}
+
+		s.stopGRPC(ctx)
+
+		// Stop the workers once nothing can produce more work for them
+		stopWorkers()
+		background.Wait()
 	}()
 
 	log.Printf("Starting the server at port %s\n", s.config.ServerPort)
-	return server.ListenAndServe()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		close(serveFailed)
+		<-shutdownDone
+		return err
+	}
+
+	// ListenAndServe returns as soon as shutdown starts, so wait for it to
+	// finish before the database is closed
+	<-shutdownDone
+	log.Println("Server stopped")
+	return nil
+}
+
+// purgeIdempotencyKeys deletes expired idempotency keys every
+// idempotencyPurgeInterval until ctx is done
+func purgeIdempotencyKeys(ctx context.Context, repo *database.IdempotencyRepository) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := repo.PurgeExpired(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("idempotency key purge: %v", err)
+			}
+		}
+	}
+}
+
+// stopGRPC drains in-flight RPCs, forcing the gRPC server to stop once ctx expires
+func (s *Server) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("gRPC server forced to shutdown")
+		s.grpcServer.Stop()
+	}
 }
@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrDestinationNotAllowed is returned when a webhook would be sent to an
+// address that is not on the public internet. The error is the same for
+// every such address, so the delivery log reveals nothing about the
+// networks behind the server.
+var ErrDestinationNotAllowed = errors.New("webhook destination address is not allowed")
+
+// blockedNetworks are the special-purpose networks not covered by the
+// methods of netip.Addr. Webhooks are never sent into them.
+var blockedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which reaches IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// AllowedDestination reports whether webhooks may be sent to addr: it must
+// be a public unicast address, unless it is in one of the allowed networks
+func AllowedDestination(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, network := range allowed {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		// Loopback, link-local (including 169.254.169.254), multicast and
+		// unspecified addresses are not global unicast
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// guardedDialer returns a dialer that refuses to connect to an address
+// AllowedDestination rejects. The check runs on the resolved address right
+// before connecting, so a host name cannot resolve to a different address
+// than the one checked.
+func guardedDialer(allowed []netip.Prefix) *net.Dialer {
+	return &net.Dialer{
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !AllowedDestination(addrPort.Addr(), allowed) {
+				return ErrDestinationNotAllowed
+			}
+			return nil
+		},
+	}
+}
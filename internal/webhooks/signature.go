@@ -0,0 +1,73 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers sent with every delivery
+const (
+	EventHeader     = "X-Noter-Event"
+	DeliveryHeader  = "X-Noter-Delivery"
+	TimestampHeader = "X-Noter-Timestamp"
+	SignatureHeader = "X-Noter-Signature"
+)
+
+// EventTypes are the note events a webhook can subscribe to
+var EventTypes = []string{"note.created", "note.updated", "note.deleted", "note.imported"}
+
+// signaturePrefix names the scheme of the signature header
+const signaturePrefix = "sha256="
+
+// ErrInvalidSignature is returned when a delivery's signature does not verify
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// NewSecret generates a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign computes the signature of a payload sent at timestamp. The timestamp
+// is signed along with the body so a captured delivery cannot be replayed
+// later with a fresh timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery, rejecting timestamps
+// further than tolerance from now. Receivers can use it as is.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	timestamp := time.Unix(unix, 0)
+	if math.Abs(float64(time.Since(timestamp))) > float64(tolerance) {
+		return ErrInvalidSignature
+	}
+
+	signature := header.Get(SignatureHeader)
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+// Enqueuer queues the deliveries of an event to the webhooks subscribed to it
+type Enqueuer interface {
+	EnqueueDeliveries(ctx context.Context, eventID int64, eventType string, payload json.RawMessage) error
+}
+
+// Sink is the outbox sink queueing webhook deliveries for note events
+type Sink struct {
+	enqueuer Enqueuer
+}
+
+// NewSink creates a new webhook outbox sink
+func NewSink(enqueuer Enqueuer) *Sink {
+	return &Sink{
+		enqueuer: enqueuer,
+	}
+}
+
+// Deliver queues the deliveries of a note event. Deliveries already queued
+// for the event are not queued again.
+func (s *Sink) Deliver(ctx context.Context, msg *models.OutboxMessage) error {
+	return s.enqueuer.EnqueueDeliveries(ctx, msg.EventID, msg.EventType, msg.Payload)
+}
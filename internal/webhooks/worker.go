@@ -0,0 +1,180 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/models"
+)
+
+const (
+	// pollInterval is how often the worker looks for due deliveries
+	pollInterval = 2 * time.Second
+	// batchSize is how many deliveries are claimed per poll
+	batchSize = 50
+	// requestTimeout bounds a single delivery attempt
+	requestTimeout = 10 * time.Second
+	// claimLease is how long a claimed delivery is hidden from other workers.
+	// It outlasts requestTimeout so an attempt in flight is never claimed twice.
+	claimLease = time.Minute
+	// MaxAttempts is how many times a delivery is attempted before it fails for good
+	MaxAttempts = 10
+	// DisableAfter is how many failed attempts in a row deactivate a webhook
+	DisableAfter = 20
+	// The bounds of the delay between attempts
+	backoffBase = 30 * time.Second
+	backoffCap  = time.Hour
+)
+
+// Store is the storage the worker claims deliveries from and records their outcome in
+type Store interface {
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*database.ClaimedDelivery, error)
+	RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt database.DeliveryAttempt) error
+}
+
+// Worker sends due webhook deliveries. Several workers may share a store, as
+// each claims its own deliveries.
+type Worker struct {
+	store  Store
+	client *http.Client
+}
+
+// NewWorker creates a new webhook delivery worker. Deliveries are only
+// sent to public addresses, or to addresses in one of allowedNetworks.
+func NewWorker(store Store, allowedNetworks []netip.Prefix) *Worker {
+	return &Worker{
+		store: store,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// Deliveries connect directly, as a proxy would connect to the
+			// destination without the dialer checking it
+			Transport: &http.Transport{
+				DialContext:         guardedDialer(allowedNetworks).DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			// A redirect is reported as the failure it is rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run delivers due deliveries until ctx is done
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhook worker: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue claims the deliveries that are due and attempts them
+// concurrently. Deliveries are retried independently too, so a receiver may
+// get the events of a note out of order and must order them by event ID.
+func (w *Worker) DeliverDue(ctx context.Context) error {
+	claimed, err := w.store.ClaimDueDeliveries(ctx, batchSize, claimLease)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range claimed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt := w.deliver(ctx, c)
+			if err := w.store.RecordAttempt(context.WithoutCancel(ctx), c.Delivery, attempt); err != nil {
+				log.Printf("webhook worker: delivery %d: %v", c.Delivery.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliver makes a single attempt at a delivery and schedules the next one
+// when it fails
+func (w *Worker) deliver(ctx context.Context, c *database.ClaimedDelivery) database.DeliveryAttempt {
+	attempt := database.DeliveryAttempt{DisableAfter: DisableAfter}
+
+	statusCode, err := w.send(ctx, c)
+	attempt.StatusCode = statusCode
+	switch {
+	case errors.Is(err, ErrDestinationNotAllowed):
+		// The address the URL resolved to is left out of the delivery log
+		attempt.Error = ErrDestinationNotAllowed.Error()
+	case err != nil:
+		attempt.Error = err.Error()
+	case statusCode < 200 || statusCode > 299:
+		attempt.Error = fmt.Sprintf("endpoint responded with %d %s", statusCode, http.StatusText(statusCode))
+	default:
+		attempt.Succeeded = true
+		return attempt
+	}
+
+	if attempts := c.Delivery.Attempts + 1; attempts < MaxAttempts {
+		retryAt := time.Now().Add(Backoff(attempts))
+		attempt.RetryAt = &retryAt
+	}
+	return attempt
+}
+
+// send posts the signed payload of a delivery and returns the response status
+func (w *Worker) send(ctx context.Context, c *database.ClaimedDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(c.Delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "noter-webhooks")
+	req.Header.Set(EventHeader, c.Delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(c.Delivery.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(c.Secret, now, c.Delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// Backoff is the delay before retrying after the given number of attempts.
+// It doubles with every attempt up to a cap, and half of it is random so
+// deliveries that failed together do not all retry together.
+func Backoff(attempts int) time.Duration {
+	delay := backoffBase
+	for i := 1; i < attempts && delay < backoffCap; i++ {
+		delay *= 2
+	}
+	delay = min(delay, backoffCap)
+	return delay/2 + rand.N(delay/2)
+}
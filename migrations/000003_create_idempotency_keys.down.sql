@@ -0,0 +1,2 @@
+-- Drop the idempotency keys table
+DROP TABLE IF EXISTS idempotency_keys;
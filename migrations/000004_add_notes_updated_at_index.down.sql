@@ -0,0 +1,2 @@
+-- Drop the notes updated_at index
+DROP INDEX IF EXISTS idx_notes_updated_at;
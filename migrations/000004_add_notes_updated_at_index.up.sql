@@ -0,0 +1,2 @@
+-- Add an index so the newest modification time of the notes is cheap to find
+CREATE INDEX IF NOT EXISTS idx_notes_updated_at ON notes(updated_at);
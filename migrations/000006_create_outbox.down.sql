@@ -0,0 +1,3 @@
+-- Drop outbox table
+DROP INDEX IF EXISTS idx_webhook_deliveries_event_id;
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,20 @@
+-- Create outbox table
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL,
+    note_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    dispatched_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Add indexes for finding the oldest pending message of each note and for purging dispatched ones
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(note_id, id) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_dispatched_at ON outbox(dispatched_at) WHERE dispatched_at IS NOT NULL;
+
+-- Add an index so webhook deliveries can be queued at most once per event
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event_id ON webhook_deliveries(webhook_id, event_id);
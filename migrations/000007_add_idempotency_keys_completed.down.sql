@@ -0,0 +1,2 @@
+-- Drop the idempotency keys completed column
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS completed;
@@ -0,0 +1,3 @@
+-- Mark whether the request holding an idempotency key has finished, so a
+-- key is claimed before its request runs and the response is stored after
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS completed BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,3 @@
+-- Restore the audit events action index
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+DROP INDEX IF EXISTS idx_audit_events_action_created_at;
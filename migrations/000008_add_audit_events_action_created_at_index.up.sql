@@ -0,0 +1,5 @@
+-- Add an index so the latest audit event of an action is cheap to find,
+-- which the notes collection version looks up on every read. It also
+-- serves the action filter, so the index on action alone is dropped.
+CREATE INDEX IF NOT EXISTS idx_audit_events_action_created_at ON audit_events(action, created_at);
+DROP INDEX IF EXISTS idx_audit_events_action;
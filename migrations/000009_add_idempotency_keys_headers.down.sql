@@ -0,0 +1,7 @@
+-- Restore the content type column from the stored headers
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS content_type VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE idempotency_keys
+SET content_type = COALESCE(headers->'Content-Type'->>0, '');
+
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS headers;
@@ -0,0 +1,9 @@
+-- Store every header of an idempotent response so replays carry ETag,
+-- Location and the like, not only its content type
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}';
+
+UPDATE idempotency_keys
+SET headers = jsonb_build_object('Content-Type', jsonb_build_array(content_type))
+WHERE content_type <> '';
+
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS content_type;
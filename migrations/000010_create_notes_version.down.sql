@@ -0,0 +1,2 @@
+-- Drop the notes version table
+DROP TABLE IF EXISTS notes_version;
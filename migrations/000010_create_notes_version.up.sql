@@ -0,0 +1,12 @@
+-- Create the notes version table, a single row every transaction changing
+-- the notes advances right before it commits. Its row lock orders the
+-- versions by commit, which the notes' own timestamps do not.
+CREATE TABLE IF NOT EXISTS notes_version (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    version BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+INSERT INTO notes_version (version, updated_at)
+VALUES (0, NOW())
+ON CONFLICT (id) DO NOTHING;
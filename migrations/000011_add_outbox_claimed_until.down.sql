@@ -0,0 +1,2 @@
+-- Drop the outbox claim lease
+ALTER TABLE outbox DROP COLUMN IF EXISTS claimed_until;
@@ -0,0 +1,3 @@
+-- Add the lease dispatchers hold on the messages they claimed, so a claim
+-- can be committed before the messages are delivered
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP WITH TIME ZONE;
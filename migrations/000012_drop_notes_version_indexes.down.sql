@@ -0,0 +1,4 @@
+-- Restore the indexes the notes collection version used to be derived with
+CREATE INDEX IF NOT EXISTS idx_notes_updated_at ON notes(updated_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action_created_at ON audit_events(action, created_at);
+DROP INDEX IF EXISTS idx_audit_events_action;
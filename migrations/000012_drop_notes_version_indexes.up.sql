@@ -0,0 +1,6 @@
+-- The notes collection version is read from notes_version, so the indexes
+-- added to derive it from the notes and the audit log are no longer used.
+-- The action filter of the audit log goes back to the index on action alone.
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+DROP INDEX IF EXISTS idx_audit_events_action_created_at;
+DROP INDEX IF EXISTS idx_notes_updated_at;
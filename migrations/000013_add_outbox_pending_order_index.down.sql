@@ -0,0 +1,2 @@
+-- Drop the index over pending outbox messages in order
+DROP INDEX IF EXISTS idx_outbox_pending_order;
@@ -0,0 +1,4 @@
+-- Add an index so dispatchers walk only the pending messages, oldest first,
+-- when looking for the head of each note, instead of every message kept
+-- since it was dispatched
+CREATE INDEX IF NOT EXISTS idx_outbox_pending_order ON outbox(id) WHERE dispatched_at IS NULL;
@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/middleware"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockHandlerAuditStore is a mock implementation of handlers.AuditStore
+type MockHandlerAuditStore struct {
+	mock.Mock
+}
+
+// ListEvents mocks the ListEvents method
+func (m *MockHandlerAuditStore) ListEvents(ctx context.Context, filter database.AuditFilter) ([]*models.AuditEvent, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.AuditEvent), args.Error(1)
+}
+
+// StreamEvents mocks the StreamEvents method by calling fn for every event
+// it is set up to return
+func (m *MockHandlerAuditStore) StreamEvents(ctx context.Context, filter database.AuditFilter, fn func(*models.AuditEvent) error) error {
+	args := m.Called(ctx, filter)
+	if events, ok := args.Get(0).([]*models.AuditEvent); ok {
+		for _, event := range events {
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+// auditEvent builds an audit event for a note
+func auditEvent(id int64, action string, noteID uuid.UUID) *models.AuditEvent {
+	return &models.AuditEvent{
+		ID:        id,
+		Action:    action,
+		NoteID:    &noteID,
+		RequestID: "req-1",
+		IP:        "192.0.2.1",
+		Diff:      json.RawMessage(`{}`),
+		CreatedAt: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestAuditDiffForCreate(t *testing.T) {
+	note := models.NewNote("Test Note")
+
+	diff, err := audit.Diff(nil, note)
+	assert.NoError(t, err)
+
+	var changes map[string]audit.Change
+	err = json.Unmarshal(diff, &changes)
+	assert.NoError(t, err)
+
+	// Every field is new on create
+	assert.Len(t, changes, 4)
+	assert.Nil(t, changes["title"].Old)
+	assert.Equal(t, "Test Note", changes["title"].New)
+}
+
+func TestAuditDiffOnlyContainsChangedFields(t *testing.T) {
+	before := models.NewNote("Old Title")
+	after := *before
+	after.Title = "New Title"
+
+	diff, err := audit.Diff(before, &after)
+	assert.NoError(t, err)
+
+	var changes map[string]audit.Change
+	err = json.Unmarshal(diff, &changes)
+	assert.NoError(t, err)
+
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "Old Title", changes["title"].Old)
+	assert.Equal(t, "New Title", changes["title"].New)
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var info audit.Info
+	handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = audit.FromContext(r.Context())
+	}))
+
+	// A request without an ID gets one generated
+	req := httptest.NewRequest("GET", "/notes", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.NotEmpty(t, info.RequestID)
+	assert.Equal(t, info.RequestID, rr.Header().Get(middleware.RequestIDHeader))
+	assert.Equal(t, "192.0.2.1", info.IP)
+
+	// A request with an ID keeps it
+	req = httptest.NewRequest("GET", "/notes", nil)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, "abc-123", info.RequestID)
+	assert.Equal(t, "abc-123", rr.Header().Get(middleware.RequestIDHeader))
+}
+
+func TestListAuditEventsParsesFilters(t *testing.T) {
+	noteID := uuid.New()
+	store := new(MockHandlerAuditStore)
+	store.On("ListEvents", AnyContext(), database.AuditFilter{
+		NoteID: &noteID,
+		Action: "note.updated",
+		From:   time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC),
+		Limit:  10,
+	}).Return([]*models.AuditEvent{auditEvent(2, "note.updated", noteID)}, nil)
+
+	req := httptest.NewRequest("GET", "/audit?note_id="+noteID.String()+
+		"&action=note.updated&from=2026-05-01T00:00:00Z&to=2026-05-02T00:00:00Z&limit=10", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewAuditHandler(store).ListEvents(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var events []models.AuditEvent
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&events))
+	assert.Len(t, events, 1)
+	assert.Equal(t, int64(2), events[0].ID)
+	store.AssertExpectations(t)
+}
+
+func TestListAuditEventsDefaultsLimit(t *testing.T) {
+	store := new(MockHandlerAuditStore)
+	store.On("ListEvents", AnyContext(), database.AuditFilter{Limit: 100}).Return([]*models.AuditEvent{}, nil)
+
+	req := httptest.NewRequest("GET", "/audit", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewAuditHandler(store).ListEvents(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, "[]", rr.Body.String())
+	store.AssertExpectations(t)
+}
+
+func TestListAuditEventsAcceptsLimitBounds(t *testing.T) {
+	for _, limit := range []int{1, 1000} {
+		store := new(MockHandlerAuditStore)
+		store.On("ListEvents", AnyContext(), database.AuditFilter{Limit: limit}).Return([]*models.AuditEvent{}, nil)
+
+		req := httptest.NewRequest("GET", "/audit?limit="+strconv.Itoa(limit), nil)
+		rr := httptest.NewRecorder()
+		handlers.NewAuditHandler(store).ListEvents(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, limit)
+		store.AssertExpectations(t)
+	}
+}
+
+func TestAuditHandlerRejectsInvalidParameters(t *testing.T) {
+	queries := map[string]string{
+		"note_id=not-a-uuid": "invalid note_id",
+		"from=yesterday":     "invalid from, expected RFC 3339 time",
+		"to=2026-05-01":      "invalid to, expected RFC 3339 time",
+		"limit=0":            "invalid limit, expected 1-1000",
+		"limit=1001":         "invalid limit, expected 1-1000",
+		"limit=ten":          "invalid limit, expected 1-1000",
+	}
+
+	handler := handlers.NewAuditHandler(new(MockHandlerAuditStore))
+	for query, detail := range queries {
+		for name, serve := range map[string]http.HandlerFunc{
+			"list":   handler.ListEvents,
+			"export": handler.ExportEvents,
+		} {
+			req := httptest.NewRequest("GET", "/audit?"+query, nil)
+			rr := httptest.NewRecorder()
+			serve(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, name+" "+query)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+			var p problem.Problem
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+			assert.Equal(t, problem.CodeInvalidParameter, p.Code)
+			assert.Equal(t, detail, p.Detail, name+" "+query)
+		}
+	}
+}
+
+func TestListAuditEventsReportsStoreErrors(t *testing.T) {
+	store := new(MockHandlerAuditStore)
+	store.On("ListEvents", AnyContext(), mock.Anything).Return(nil, assert.AnError)
+
+	req := httptest.NewRequest("GET", "/audit", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewAuditHandler(store).ListEvents(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+}
+
+func TestExportAuditEventsWritesNDJSON(t *testing.T) {
+	noteID := uuid.New()
+	store := new(MockHandlerAuditStore)
+	store.On("StreamEvents", AnyContext(), database.AuditFilter{Action: "note.created"}).Return([]*models.AuditEvent{
+		auditEvent(2, "note.created", noteID),
+		auditEvent(1, "note.created", noteID),
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/audit/export?action=note.created", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewAuditHandler(store).ExportEvents(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+
+	// The export is not paginated, so no limit is applied, and every event
+	// is written on its own line
+	var ids []int64
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []int64{2, 1}, ids)
+	store.AssertExpectations(t)
+}
@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// serveBatch runs the batch handler, accepting at most three operations
+func serveBatch(store *MockHandlerNoteStore, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/notes/batch"+query, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handlers.NewNoteHandler(store, handlers.V1Presenter{}, 3).Batch(rr, req)
+	return rr
+}
+
+// decodeBatch decodes a batch response
+func decodeBatch(t *testing.T, rr *httptest.ResponseRecorder) handlers.BatchResponse {
+	var resp handlers.BatchResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp
+}
+
+// statuses returns the status of every operation of a batch response
+func statuses(resp handlers.BatchResponse) []int {
+	codes := make([]int, len(resp.Results))
+	for i, result := range resp.Results {
+		codes[i] = result.Status
+	}
+	return codes
+}
+
+func TestBatchRejectsInvalidOperations(t *testing.T) {
+	store := new(MockHandlerNoteStore)
+	rr := serveBatch(store, "", `{"operations": [
+		{"op": "create", "title": ""},
+		{"op": "update", "id": "not-a-uuid", "title": "New title"},
+		{"op": "rename", "id": "`+uuid.NewString()+`"}
+	]}`)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+
+	fields := make([]string, len(p.Errors))
+	for i, fieldErr := range p.Errors {
+		fields[i] = fieldErr.Field
+	}
+	assert.Equal(t, []string{"operations[0].title", "operations[1].id", "operations[2].op"}, fields)
+	store.AssertNotCalled(t, "ExecBatch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBatchRejectsEmptyAndMalformedBodies(t *testing.T) {
+	for body, code := range map[string]string{
+		`{"operations": []}`: problem.CodeValidationFailed,
+		`{}`:                 problem.CodeValidationFailed,
+		`{"operations": `:    problem.CodeInvalidRequestBody,
+	} {
+		store := new(MockHandlerNoteStore)
+		rr := serveBatch(store, "", body)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		var p problem.Problem
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+		assert.Equal(t, code, p.Code, body)
+		store.AssertNotCalled(t, "ExecBatch", mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestBatchEnforcesOperationLimit(t *testing.T) {
+	store := new(MockHandlerNoteStore)
+	op := `{"op": "create", "title": "Note"}`
+	rr := serveBatch(store, "", `{"operations": [`+strings.Repeat(op+",", 3)+op+`]}`)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, []database.FieldError{{Field: "operations", Message: "must contain at most 3 operations"}}, p.Errors)
+	store.AssertNotCalled(t, "ExecBatch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBatchRejectsInvalidAtomicParameter(t *testing.T) {
+	store := new(MockHandlerNoteStore)
+	rr := serveBatch(store, "?atomic=sometimes", `{"operations": [{"op": "create", "title": "Note"}]}`)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeInvalidParameter, p.Code)
+	store.AssertNotCalled(t, "ExecBatch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBatchSucceeds(t *testing.T) {
+	note := models.NewNote("Note")
+	store := new(MockHandlerNoteStore)
+	store.On("ExecBatch", AnyContext(), mock.Anything, true).Return([]database.BatchResult{
+		{Note: note},
+		{Note: note},
+	}, nil)
+
+	rr := serveBatch(store, "", `{"operations": [
+		{"op": "create", "title": "Note"},
+		{"op": "delete", "id": "`+note.ID.String()+`"}
+	]}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	resp := decodeBatch(t, rr)
+	assert.True(t, resp.Atomic)
+	assert.Equal(t, 2, resp.Succeeded)
+	assert.Equal(t, 0, resp.Failed)
+	assert.Equal(t, []int{http.StatusCreated, http.StatusOK}, statuses(resp))
+
+	// The operations reach the repository in the order they were submitted
+	ops := store.Calls[0].Arguments.Get(1).([]database.BatchOperation)
+	assert.Equal(t, database.BatchCreate, ops[0].Op)
+	assert.Equal(t, "Note", ops[0].Note.Title)
+	assert.Equal(t, database.BatchDelete, ops[1].Op)
+	assert.Equal(t, note.ID, ops[1].ID)
+}
+
+func TestAtomicBatchFailureAbortsOtherOperations(t *testing.T) {
+	store := new(MockHandlerNoteStore)
+	store.On("ExecBatch", AnyContext(), mock.Anything, true).Return([]database.BatchResult{
+		{Err: database.ErrBatchAborted},
+		{Err: fmt.Errorf("failed to update note: %w", database.ErrNotFound)},
+		{Err: database.ErrBatchAborted},
+	}, nil)
+
+	rr := serveBatch(store, "?atomic=true", `{"operations": [
+		{"op": "create", "title": "Note"},
+		{"op": "update", "id": "`+uuid.NewString()+`", "title": "Missing"},
+		{"op": "create", "title": "Another note"}
+	]}`)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code)
+	resp := decodeBatch(t, rr)
+	assert.True(t, resp.Atomic)
+	assert.Equal(t, 0, resp.Succeeded)
+	assert.Equal(t, 3, resp.Failed)
+	assert.Equal(t, []int{http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency}, statuses(resp))
+	assert.Equal(t, problem.CodeBatchAborted, resp.Results[0].Error.Code)
+	assert.Equal(t, problem.CodeNotFound, resp.Results[1].Error.Code)
+	assert.Nil(t, resp.Results[0].Note)
+	store.AssertExpectations(t)
+}
+
+func TestNonAtomicBatchReportsPartialSuccess(t *testing.T) {
+	note := models.NewNote("Note")
+	store := new(MockHandlerNoteStore)
+	store.On("ExecBatch", AnyContext(), mock.Anything, false).Return([]database.BatchResult{
+		{Note: note},
+		{Err: fmt.Errorf("failed to delete note: %w", database.ErrNotFound)},
+	}, nil)
+
+	rr := serveBatch(store, "?atomic=false", `{"operations": [
+		{"op": "create", "title": "Note"},
+		{"op": "delete", "id": "`+uuid.NewString()+`"}
+	]}`)
+
+	assert.Equal(t, http.StatusMultiStatus, rr.Code)
+	resp := decodeBatch(t, rr)
+	assert.False(t, resp.Atomic)
+	assert.Equal(t, 1, resp.Succeeded)
+	assert.Equal(t, 1, resp.Failed)
+	assert.Equal(t, []int{http.StatusCreated, http.StatusNotFound}, statuses(resp))
+	assert.NotNil(t, resp.Results[0].Note)
+	store.AssertExpectations(t)
+}
+
+func TestBatchReportsRepositoryFailure(t *testing.T) {
+	store := new(MockHandlerNoteStore)
+	store.On("ExecBatch", AnyContext(), mock.Anything, true).Return(nil, fmt.Errorf("failed to begin transaction: connection refused"))
+
+	rr := serveBatch(store, "", `{"operations": [{"op": "create", "title": "Note"}]}`)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "connection refused")
+}
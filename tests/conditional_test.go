@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockHandlerNoteStore is a mock implementation of handlers.NoteStore
+type MockHandlerNoteStore struct {
+	mock.Mock
+}
+
+// CreateNote mocks the CreateNote method
+func (m *MockHandlerNoteStore) CreateNote(ctx context.Context, note *models.Note) error {
+	args := m.Called(ctx, note)
+	return args.Error(0)
+}
+
+// GetNotesVersion mocks the GetNotesVersion method
+func (m *MockHandlerNoteStore) GetNotesVersion(ctx context.Context) (*database.NotesVersion, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*database.NotesVersion), args.Error(1)
+}
+
+// GetAllNotes mocks the GetAllNotes method
+func (m *MockHandlerNoteStore) GetAllNotes(ctx context.Context) ([]*models.Note, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Note), args.Error(1)
+}
+
+// GetNoteByID mocks the GetNoteByID method
+func (m *MockHandlerNoteStore) GetNoteByID(ctx context.Context, id uuid.UUID) (*models.Note, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Note), args.Error(1)
+}
+
+// UpdateNote mocks the UpdateNote method by applying fn to the note it is
+// set up to return, as the repository does with the stored note
+func (m *MockHandlerNoteStore) UpdateNote(ctx context.Context, id uuid.UUID, fn func(*models.Note) error) (*models.Note, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	note := *args.Get(0).(*models.Note)
+	if err := fn(&note); err != nil {
+		return nil, err
+	}
+	return &note, args.Error(1)
+}
+
+// ExecBatch mocks the ExecBatch method
+func (m *MockHandlerNoteStore) ExecBatch(ctx context.Context, ops []database.BatchOperation, atomic bool) ([]database.BatchResult, error) {
+	args := m.Called(ctx, ops, atomic)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]database.BatchResult), args.Error(1)
+}
+
+// getNote sends a GET for a note to the handler with the given headers
+func getNote(store *MockHandlerNoteStore, id uuid.UUID, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/notes/"+id.String(), nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": id.String()})
+	rr := httptest.NewRecorder()
+	handlers.NewNoteHandler(store, handlers.V1Presenter{}, 100).GetNoteByID(rr, req)
+	return rr
+}
+
+// getNotes sends a GET for the notes collection to the handler with the given headers
+func getNotes(store *MockHandlerNoteStore, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/notes", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rr := httptest.NewRecorder()
+	handlers.NewNoteHandler(store, handlers.V1Presenter{}, 100).GetAllNotes(rr, req)
+	return rr
+}
+
+func TestGetNoteSetsValidators(t *testing.T) {
+	note := models.NewNote("Test Note")
+	store := new(MockHandlerNoteStore)
+	store.On("GetNoteByID", mock.Anything, note.ID).Return(note, nil)
+
+	rr := getNote(store, note.ID, nil)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("ETag"))
+	assert.Equal(t, note.UpdatedAt.UTC().Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+}
+
+func TestGetNoteNotModifiedOnMatchingETag(t *testing.T) {
+	note := models.NewNote("Test Note")
+	store := new(MockHandlerNoteStore)
+	store.On("GetNoteByID", mock.Anything, note.ID).Return(note, nil)
+	etag := getNote(store, note.ID, nil).Header().Get("ETag")
+
+	for _, ifNoneMatch := range []string{
+		etag,
+		"W/" + etag,
+		`"other", ` + etag,
+		"*",
+	} {
+		rr := getNote(store, note.ID, http.Header{"If-None-Match": {ifNoneMatch}})
+
+		assert.Equal(t, http.StatusNotModified, rr.Code, ifNoneMatch)
+		assert.Empty(t, rr.Body.String())
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+	}
+
+	rr := getNote(store, note.ID, http.Header{"If-None-Match": {`"other"`}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestGetNoteIfModifiedSince(t *testing.T) {
+	note := models.NewNote("Test Note")
+	note.UpdatedAt = time.Date(2026, 5, 1, 12, 0, 0, 500, time.UTC)
+	store := new(MockHandlerNoteStore)
+	store.On("GetNoteByID", mock.Anything, note.ID).Return(note, nil)
+
+	// HTTP dates drop the fraction of a second the note was updated in
+	rr := getNote(store, note.ID, http.Header{"If-Modified-Since": {"Fri, 01 May 2026 12:00:00 GMT"}})
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	rr = getNote(store, note.ID, http.Header{"If-Modified-Since": {"Fri, 01 May 2026 11:59:59 GMT"}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = getNote(store, note.ID, http.Header{"If-Modified-Since": {"yesterday"}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// If-None-Match takes precedence over If-Modified-Since
+	rr = getNote(store, note.ID, http.Header{
+		"If-None-Match":     {`"other"`},
+		"If-Modified-Since": {"Sat, 02 May 2026 12:00:00 GMT"},
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestGetNoteVariantsHaveDistinctETags(t *testing.T) {
+	note := models.NewNote("Test Note")
+	store := new(MockHandlerNoteStore)
+	store.On("GetNoteByID", mock.Anything, note.ID).Return(note, nil)
+
+	jsonETag := getNote(store, note.ID, http.Header{"Accept": {"application/json"}}).Header().Get("ETag")
+	markdownETag := getNote(store, note.ID, http.Header{"Accept": {"text/markdown"}}).Header().Get("ETag")
+	assert.NotEqual(t, jsonETag, markdownETag)
+
+	rr := getNote(store, note.ID, http.Header{"Accept": {"text/markdown"}, "If-None-Match": {jsonETag}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestGetNotesNotModifiedSkipsLoadingNotes(t *testing.T) {
+	version := &database.NotesVersion{Version: 2, LastModified: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	store := new(MockHandlerNoteStore)
+	store.On("GetNotesVersion", mock.Anything).Return(version, nil)
+	store.On("GetAllNotes", mock.Anything).Return([]*models.Note{models.NewNote("Note 1"), models.NewNote("Note 2")}, nil).Once()
+
+	rr := getNotes(store, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+
+	rr = getNotes(store, http.Header{"If-None-Match": {"W/" + etag}})
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	rr = getNotes(store, http.Header{"If-Modified-Since": {"Fri, 01 May 2026 12:00:00 GMT"}})
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	store.AssertNumberOfCalls(t, "GetAllNotes", 1)
+}
+
+func TestGetNotesETagChangesWithVersion(t *testing.T) {
+	before := &database.NotesVersion{Version: 2, LastModified: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	// A change committed since advances the version, even when the clock
+	// has not moved on
+	after := &database.NotesVersion{Version: 3, LastModified: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	store := new(MockHandlerNoteStore)
+	store.On("GetNotesVersion", mock.Anything).Return(before, nil).Once()
+	store.On("GetNotesVersion", mock.Anything).Return(after, nil)
+	store.On("GetAllNotes", mock.Anything).Return([]*models.Note{}, nil)
+
+	etag := getNotes(store, nil).Header().Get("ETag")
+	rr := getNotes(store, http.Header{"If-None-Match": {etag}})
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+	var notes []*models.Note
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&notes))
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/moabdelazem/noter/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRejectsNonPositiveIdempotencyTTL(t *testing.T) {
+	for _, ttl := range []string{"0s", "-1h"} {
+		t.Setenv("IDEMPOTENCY_TTL", ttl)
+		_, err := config.Load()
+		assert.ErrorContains(t, err, "IDEMPOTENCY_TTL", ttl)
+	}
+
+	t.Setenv("IDEMPOTENCY_TTL", "1h")
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "1h0m0s", cfg.IdempotencyTTL.String())
+}
+
+func TestLoadReadsBatchLimit(t *testing.T) {
+	for _, limit := range []string{"0", "-5", "many"} {
+		t.Setenv("BATCH_MAX_OPERATIONS", limit)
+		_, err := config.Load()
+		assert.ErrorContains(t, err, "BATCH_MAX_OPERATIONS", limit)
+	}
+
+	t.Setenv("BATCH_MAX_OPERATIONS", "250")
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 250, cfg.MaxBatchOperations)
+}
+
+func TestLoadReadsWebhookAllowedNetworks(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "10.1.2.0/24, 192.168.1.7 ,fd00::/8")
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.1.2.0/24"),
+		netip.MustParsePrefix("192.168.1.7/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}, cfg.WebhookAllowedNetworks)
+
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "10.1.2.0/33")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "WEBHOOK_ALLOWED_NETWORKS")
+
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "")
+	cfg, err = config.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.WebhookAllowedNetworks)
+}
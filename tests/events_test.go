@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/events"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/stretchr/testify/assert"
+)
+
+func noteEvent(id, typ string) events.Event {
+	return events.Event{ID: id, Type: typ, Data: json.RawMessage(`{"id":` + id + `,"type":"` + typ + `"}`)}
+}
+
+func TestBrokerDeliversPublishedEvents(t *testing.T) {
+	broker := events.NewBroker(10)
+	sub, resumed := broker.Subscribe("")
+	defer broker.Unsubscribe(sub)
+
+	broker.Publish(noteEvent("1", "created"))
+
+	assert.True(t, resumed)
+	assert.Empty(t, sub.Replay)
+	assert.Equal(t, "1", (<-sub.Events()).ID)
+}
+
+func TestBrokerReplaysMissedEvents(t *testing.T) {
+	broker := events.NewBroker(10)
+	for _, id := range []string{"1", "2", "3"} {
+		broker.Publish(noteEvent(id, "updated"))
+	}
+
+	sub, resumed := broker.Subscribe("1")
+	defer broker.Unsubscribe(sub)
+
+	assert.True(t, resumed)
+	if assert.Len(t, sub.Replay, 2) {
+		assert.Equal(t, "2", sub.Replay[0].ID)
+		assert.Equal(t, "3", sub.Replay[1].ID)
+	}
+}
+
+func TestBrokerReplayBufferIsBounded(t *testing.T) {
+	broker := events.NewBroker(2)
+	for _, id := range []string{"1", "2", "3"} {
+		broker.Publish(noteEvent(id, "updated"))
+	}
+
+	// Event 1 has been evicted, so the subscriber cannot resume after it
+	sub, resumed := broker.Subscribe("1")
+	defer broker.Unsubscribe(sub)
+
+	assert.False(t, resumed)
+	assert.Empty(t, sub.Replay)
+}
+
+func TestBrokerResetDisconnectsSubscribers(t *testing.T) {
+	broker := events.NewBroker(10)
+	broker.Publish(noteEvent("1", "created"))
+	sub, _ := broker.Subscribe("")
+
+	broker.Reset()
+
+	_, open := <-sub.Events()
+	assert.False(t, open)
+	_, resumed := broker.Subscribe("1")
+	assert.False(t, resumed)
+}
+
+func TestEventStream(t *testing.T) {
+	broker := events.NewBroker(10)
+	broker.Publish(noteEvent("1", "created"))
+	broker.Publish(noteEvent("2", "updated"))
+
+	server := httptest.NewServer(http.HandlerFunc(handlers.NewEventHandler(broker).Stream))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The missed event is replayed, then live events follow
+	broker.Publish(noteEvent("3", "deleted"))
+
+	var ids, types []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(types) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+		if typ, ok := strings.CutPrefix(line, "event: "); ok {
+			types = append(types, typ)
+		}
+	}
+
+	assert.Equal(t, []string{"2", "3"}, ids)
+	assert.Equal(t, []string{"updated", "deleted"}, types)
+}
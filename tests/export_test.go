@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExportStore streams a fixed list of notes and records the filter it got
+type fakeExportStore struct {
+	notes  []*models.Note
+	filter database.NoteFilter
+}
+
+// StreamNotes calls fn for every note
+func (s *fakeExportStore) StreamNotes(ctx context.Context, filter database.NoteFilter, fn func(*models.Note) error) error {
+	s.filter = filter
+	return s.ExportNotes(ctx, fn)
+}
+
+// ExportNotes calls fn for every note
+func (s *fakeExportStore) ExportNotes(ctx context.Context, fn func(*models.Note) error) error {
+	for _, note := range s.notes {
+		if err := fn(note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportedNote builds a note with a fixed ID and timestamps
+func exportedNote(id, title string) *models.Note {
+	return &models.Note{
+		ID:        uuid.MustParse(id),
+		Title:     title,
+		CreatedAt: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2026, 5, 2, 8, 30, 0, 0, time.UTC),
+	}
+}
+
+// readZip returns the files of a zip archive by name
+func readZip(t *testing.T, data []byte) map[string]string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		f, err := file.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		f.Close()
+		files[file.Name] = string(content)
+	}
+	return files
+}
+
+func TestExportMarkdownRejectsInvalidDates(t *testing.T) {
+	handler := handlers.NewExportHandler(nil)
+
+	for _, query := range []string{"created_after=yesterday", "created_before=2026-13-01"} {
+		req := httptest.NewRequest("GET", "/export/markdown?"+query, nil)
+		rr := httptest.NewRecorder()
+		handler.ExportMarkdown(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+		var p problem.Problem
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+		assert.Equal(t, problem.CodeInvalidParameter, p.Code)
+	}
+}
+
+func TestExportMarkdownWritesOneFilePerNote(t *testing.T) {
+	store := &fakeExportStore{notes: []*models.Note{
+		exportedNote("00000000-0000-0000-0000-000000000001", "Weekly Plan: Q3!"),
+		exportedNote("00000000-0000-0000-0000-000000000002", "Weekly plan q3"),
+		exportedNote("00000000-0000-0000-0000-000000000003", "???"),
+		exportedNote("00000000-0000-0000-0000-000000000004", "Café "+strings.Repeat("x", 80)),
+	}}
+	req := httptest.NewRequest("GET", "/export/markdown?created_after=2026-01-01T00:00:00Z", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewExportHandler(store).ExportMarkdown(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), store.filter.CreatedAfter)
+
+	files := readZip(t, rr.Body.Bytes())
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	// Titles that slug alike still get distinct names through their IDs,
+	// and titles without letters or digits fall back to the ID alone
+	assert.ElementsMatch(t, []string{
+		"weekly-plan-q3-00000000-0000-0000-0000-000000000001.md",
+		"weekly-plan-q3-00000000-0000-0000-0000-000000000002.md",
+		"00000000-0000-0000-0000-000000000003.md",
+		"café-" + strings.Repeat("x", 55) + "-00000000-0000-0000-0000-000000000004.md",
+	}, names)
+
+	assert.Equal(t, "---\n"+
+		"id: 00000000-0000-0000-0000-000000000001\n"+
+		"title: \"Weekly Plan: Q3!\"\n"+
+		"created_at: 2026-05-01T12:00:00Z\n"+
+		"updated_at: 2026-05-02T08:30:00Z\n"+
+		"---\n\n"+
+		"# Weekly Plan: Q3!\n", files["weekly-plan-q3-00000000-0000-0000-0000-000000000001.md"])
+}
+
+func TestExportMarkdownFlattensMultilineTitles(t *testing.T) {
+	store := &fakeExportStore{notes: []*models.Note{
+		exportedNote("00000000-0000-0000-0000-000000000001", "First line\n---\nlayout: evil\r\n# Second"),
+	}}
+	req := httptest.NewRequest("GET", "/export/markdown", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewExportHandler(store).ExportMarkdown(rr, req)
+
+	files := readZip(t, rr.Body.Bytes())
+	content := files["first-line-layout-evil-second-00000000-0000-0000-0000-000000000001.md"]
+	assert.Equal(t, "---\n"+
+		"id: 00000000-0000-0000-0000-000000000001\n"+
+		"title: \"First line\\n---\\nlayout: evil\\r\\n# Second\"\n"+
+		"created_at: 2026-05-01T12:00:00Z\n"+
+		"updated_at: 2026-05-02T08:30:00Z\n"+
+		"---\n\n"+
+		"# First line --- layout: evil \\# Second\n", content)
+	// The front matter is the only block delimited by ---
+	assert.Equal(t, 2, strings.Count(content, "---\n"))
+}
+
+func TestExportMarkdownEscapesTitles(t *testing.T) {
+	for title, heading := range map[string]string{
+		"Release C#":            `# Release C\#`,
+		"Issue #42 #":           `# Issue \#42 \#`,
+		"*draft* [link](x)":     `# \*draft\* \[link\](x)`,
+		"snake_case `code` <b>": "# snake\\_case \\`code\\` \\<b\\>",
+		`a\b & ~c~`:             `# a\\b \& \~c\~`,
+	} {
+		store := &fakeExportStore{notes: []*models.Note{exportedNote("00000000-0000-0000-0000-000000000001", title)}}
+		req := httptest.NewRequest("GET", "/export/markdown", nil)
+		rr := httptest.NewRecorder()
+		handlers.NewExportHandler(store).ExportMarkdown(rr, req)
+
+		for _, content := range readZip(t, rr.Body.Bytes()) {
+			assert.True(t, strings.HasSuffix(content, "\n\n"+heading+"\n"), "%q rendered as %q", title, content)
+		}
+	}
+}
+
+func TestExportMarkdownFilterErrorsAreLowercase(t *testing.T) {
+	req := httptest.NewRequest("GET", "/export/markdown?created_after=yesterday", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewExportHandler(nil).ExportMarkdown(rr, req)
+
+	var p problem.Problem
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, "invalid created_after, expected RFC 3339 time", p.Detail)
+}
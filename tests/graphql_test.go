@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/graph"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockNoteStore is a mock implementation of graph.NoteStore
+type MockNoteStore struct {
+	mock.Mock
+}
+
+func (m *MockNoteStore) CreateNote(ctx context.Context, note *models.Note) error {
+	args := m.Called(ctx, note)
+	return args.Error(0)
+}
+
+func (m *MockNoteStore) ListNotes(ctx context.Context, filter database.NoteFilter) ([]*models.Note, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]*models.Note), args.Error(1)
+}
+
+func (m *MockNoteStore) GetNotesByIDs(ctx context.Context, ids []uuid.UUID) ([]*models.Note, error) {
+	args := m.Called(ctx, ids)
+	return args.Get(0).([]*models.Note), args.Error(1)
+}
+
+func (m *MockNoteStore) UpdateNote(ctx context.Context, id uuid.UUID, fn func(*models.Note) error) (*models.Note, error) {
+	args := m.Called(ctx, id, fn)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Note), args.Error(1)
+}
+
+func (m *MockNoteStore) DeleteNote(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockAuditStore is a mock implementation of graph.AuditStore
+type MockAuditStore struct {
+	mock.Mock
+}
+
+func (m *MockAuditStore) EventsByNoteIDs(ctx context.Context, ids []uuid.UUID, limit int) (map[uuid.UUID][]*models.AuditEvent, error) {
+	args := m.Called(ctx, ids, limit)
+	return args.Get(0).(map[uuid.UUID][]*models.AuditEvent), args.Error(1)
+}
+
+// graphQLResponse is the decoded body of a GraphQL response
+type graphQLResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// doGraphQL sends a query to the handler and decodes the response
+func doGraphQL(t *testing.T, handler http.Handler, query string) (int, graphQLResponse) {
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var response graphQLResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return rr.Code, response
+}
+
+func TestGraphQLBatchesAuditEventsForNoteList(t *testing.T) {
+	noteStore := new(MockNoteStore)
+	auditStore := new(MockAuditStore)
+
+	notes := []*models.Note{models.NewNote("Note 1"), models.NewNote("Note 2"), models.NewNote("Note 3")}
+	noteStore.On("ListNotes", mock.Anything, mock.Anything).Return(notes, nil).Once()
+	auditStore.On("EventsByNoteIDs", mock.Anything, mock.MatchedBy(func(ids []uuid.UUID) bool {
+		return len(ids) == 3
+	}), 20).Return(map[uuid.UUID][]*models.AuditEvent{
+		notes[0].ID: {{ID: 1, Action: "note.create", NoteID: &notes[0].ID, Diff: json.RawMessage(`{}`)}},
+	}, nil).Once()
+
+	handler := graph.NewHandler(noteStore, auditStore)
+	status, response := doGraphQL(t, handler, `{ notes(first: 10) { nodes { title auditEvents { action } } pageInfo { hasNextPage } } }`)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{
+		"nodes": [
+			{"title": "Note 1", "auditEvents": [{"action": "note.create"}]},
+			{"title": "Note 2", "auditEvents": []},
+			{"title": "Note 3", "auditEvents": []}
+		],
+		"pageInfo": {"hasNextPage": false}
+	}`, string(response.Data["notes"]))
+
+	// A single audit query serves every note in the list
+	noteStore.AssertExpectations(t)
+	auditStore.AssertExpectations(t)
+}
+
+func TestGraphQLBatchesNoteLookups(t *testing.T) {
+	noteStore := new(MockNoteStore)
+	auditStore := new(MockAuditStore)
+
+	note1 := models.NewNote("Note 1")
+	note2 := models.NewNote("Note 2")
+	noteStore.On("GetNotesByIDs", mock.Anything, mock.MatchedBy(func(ids []uuid.UUID) bool {
+		return len(ids) == 2
+	})).Return([]*models.Note{note1, note2}, nil).Once()
+
+	handler := graph.NewHandler(noteStore, auditStore)
+	query := fmt.Sprintf(`{ a: note(id: "%s") { title } b: note(id: "%s") { title } }`, note1.ID, note2.ID)
+	status, response := doGraphQL(t, handler, query)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"title": "Note 1"}`, string(response.Data["a"]))
+	assert.JSONEq(t, `{"title": "Note 2"}`, string(response.Data["b"]))
+	noteStore.AssertExpectations(t)
+}
+
+func TestGraphQLRejectsDeepQueries(t *testing.T) {
+	noteStore := new(MockNoteStore)
+	auditStore := new(MockAuditStore)
+
+	handler := graph.NewHandler(noteStore, auditStore)
+	status, response := doGraphQL(t, handler, `{ notes { nodes { auditEvents { note { auditEvents { note { auditEvents { action } } } } } } } }`)
+
+	assert.Equal(t, http.StatusBadRequest, status)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Contains(t, response.Errors[0].Message, "depth")
+	}
+	noteStore.AssertNotCalled(t, "ListNotes")
+}
+
+func TestGraphQLRejectsComplexQueries(t *testing.T) {
+	noteStore := new(MockNoteStore)
+	auditStore := new(MockAuditStore)
+
+	handler := graph.NewHandler(noteStore, auditStore)
+	status, response := doGraphQL(t, handler, `{ notes(first: 100) { nodes { auditEvents { note { id title createdAt updatedAt } } } } }`)
+
+	assert.Equal(t, http.StatusBadRequest, status)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Contains(t, response.Errors[0].Message, "complexity")
+	}
+	noteStore.AssertNotCalled(t, "ListNotes")
+}
+
+func TestGraphQLLimitsAuditEvents(t *testing.T) {
+	noteStore := new(MockNoteStore)
+	auditStore := new(MockAuditStore)
+
+	note := models.NewNote("Note 1")
+	noteStore.On("GetNotesByIDs", mock.Anything, []uuid.UUID{note.ID}).Return([]*models.Note{note}, nil).Once()
+	auditStore.On("EventsByNoteIDs", mock.Anything, []uuid.UUID{note.ID}, 5).Return(map[uuid.UUID][]*models.AuditEvent{}, nil).Once()
+
+	handler := graph.NewHandler(noteStore, auditStore)
+	status, response := doGraphQL(t, handler, fmt.Sprintf(`{ note(id: "%s") { auditEvents(first: 5) { action } } }`, note.ID))
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, response.Errors)
+	assert.JSONEq(t, `{"auditEvents": []}`, string(response.Data["note"]))
+	auditStore.AssertExpectations(t)
+}
+
+func TestGraphQLRejectsInvalidPageSizes(t *testing.T) {
+	for _, query := range []string{
+		`{ notes(first: -1) { nodes { id } } }`,
+		`{ notes(first: 101) { nodes { id } } }`,
+	} {
+		noteStore := new(MockNoteStore)
+		handler := graph.NewHandler(noteStore, new(MockAuditStore))
+		_, response := doGraphQL(t, handler, query)
+
+		if assert.Len(t, response.Errors, 1, query) {
+			assert.Contains(t, response.Errors[0].Message, "first must be between 1 and 100")
+		}
+		noteStore.AssertNotCalled(t, "ListNotes")
+	}
+}
+
+func TestGraphQLNegativePageSizeDoesNotLowerComplexity(t *testing.T) {
+	noteStore := new(MockNoteStore)
+	auditStore := new(MockAuditStore)
+
+	handler := graph.NewHandler(noteStore, auditStore)
+	query := `{
+		a: notes(first: -100000) { nodes { auditEvents(first: -100000) { note { id title } } } }
+		b: notes(first: 100) { nodes { auditEvents(first: 100) { note { id title } } } }
+	}`
+	status, response := doGraphQL(t, handler, query)
+
+	assert.Equal(t, http.StatusBadRequest, status)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Contains(t, response.Errors[0].Message, "complexity")
+	}
+	noteStore.AssertNotCalled(t, "ListNotes")
+}
+
+func TestGraphQLCreateNoteWithEmptyTitle(t *testing.T) {
+	noteStore := new(MockNoteStore)
+	auditStore := new(MockAuditStore)
+
+	handler := graph.NewHandler(noteStore, auditStore)
+	status, response := doGraphQL(t, handler, `mutation { createNote(title: "") { id } }`)
+
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "validation failed: title is required", response.Errors[0].Message)
+	}
+	noteStore.AssertNotCalled(t, "CreateNote")
+}
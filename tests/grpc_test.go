@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/database"
+	noterv1 "github.com/moabdelazem/noter/internal/gen/noter/v1"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// MockRPCNoteStore is a mock implementation of rpc.NoteStore
+type MockRPCNoteStore struct {
+	MockNoteStore
+}
+
+func (m *MockRPCNoteStore) GetNoteByID(ctx context.Context, id uuid.UUID) (*models.Note, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Note), args.Error(1)
+}
+
+// startGRPCServer serves the gRPC API over an in-memory connection
+func startGRPCServer(t *testing.T, store rpc.NoteStore) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server, _ := rpc.NewServer(store)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCCreateNote(t *testing.T) {
+	store := new(MockRPCNoteStore)
+	store.On("CreateNote", mock.Anything, mock.MatchedBy(func(note *models.Note) bool {
+		return note.Title == "Test Note"
+	})).Return(nil)
+
+	client := noterv1.NewNoteServiceClient(startGRPCServer(t, store))
+	resp, err := client.CreateNote(context.Background(), &noterv1.CreateNoteRequest{Title: "Test Note"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Test Note", resp.GetNote().GetTitle())
+	assert.NotEmpty(t, resp.GetNote().GetId())
+	store.AssertExpectations(t)
+}
+
+func TestGRPCCreateNoteWithEmptyTitle(t *testing.T) {
+	store := new(MockRPCNoteStore)
+
+	client := noterv1.NewNoteServiceClient(startGRPCServer(t, store))
+	_, err := client.CreateNote(context.Background(), &noterv1.CreateNoteRequest{})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	store.AssertNotCalled(t, "CreateNote")
+}
+
+func TestGRPCUpdateNoteWithLongTitle(t *testing.T) {
+	store := new(MockRPCNoteStore)
+
+	client := noterv1.NewNoteServiceClient(startGRPCServer(t, store))
+	_, err := client.UpdateNote(context.Background(), &noterv1.UpdateNoteRequest{Id: uuid.NewString(), Title: strings.Repeat("a", 256)})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "validation failed: title must be at most 255 characters", status.Convert(err).Message())
+	store.AssertNotCalled(t, "UpdateNote")
+}
+
+func TestGRPCMasksInternalErrors(t *testing.T) {
+	store := new(MockRPCNoteStore)
+	noteID := uuid.New()
+	store.On("GetNoteByID", mock.Anything, noteID).Return(nil, errors.New("connection refused by 10.0.0.5"))
+
+	client := noterv1.NewNoteServiceClient(startGRPCServer(t, store))
+	_, err := client.GetNote(context.Background(), &noterv1.GetNoteRequest{Id: noteID.String()})
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "internal error", status.Convert(err).Message())
+}
+
+func TestGRPCGetNoteNotFound(t *testing.T) {
+	store := new(MockRPCNoteStore)
+	noteID := uuid.New()
+	store.On("GetNoteByID", mock.Anything, noteID).Return(nil, fmt.Errorf("failed to get note by ID: %w", database.ErrNotFound))
+
+	client := noterv1.NewNoteServiceClient(startGRPCServer(t, store))
+	_, err := client.GetNote(context.Background(), &noterv1.GetNoteRequest{Id: noteID.String()})
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	store.AssertExpectations(t)
+}
+
+func TestGRPCListNotesStreamsEveryPage(t *testing.T) {
+	store := new(MockRPCNoteStore)
+
+	firstPage := make([]*models.Note, 100)
+	for i := range firstPage {
+		firstPage[i] = models.NewNote(fmt.Sprintf("Note %d", i))
+	}
+	secondPage := []*models.Note{models.NewNote("Last Note")}
+
+	store.On("ListNotes", mock.Anything, mock.MatchedBy(func(filter database.NoteFilter) bool {
+		return filter.After == nil
+	})).Return(firstPage, nil).Once()
+	store.On("ListNotes", mock.Anything, mock.MatchedBy(func(filter database.NoteFilter) bool {
+		return filter.After != nil && filter.After.ID == firstPage[99].ID
+	})).Return(secondPage, nil).Once()
+
+	client := noterv1.NewNoteServiceClient(startGRPCServer(t, store))
+	stream, err := client.ListNotes(context.Background(), &noterv1.ListNotesRequest{})
+	assert.NoError(t, err)
+
+	var titles []string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		titles = append(titles, resp.GetNote().GetTitle())
+	}
+
+	assert.Len(t, titles, 101)
+	assert.Equal(t, "Last Note", titles[100])
+	store.AssertExpectations(t)
+}
+
+func TestGRPCListNotesCarriesRequestInfo(t *testing.T) {
+	store := new(MockRPCNoteStore)
+	var info audit.Info
+	store.On("ListNotes", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		info = audit.FromContext(args.Get(0).(context.Context))
+	}).Return([]*models.Note{}, nil).Once()
+
+	client := noterv1.NewNoteServiceClient(startGRPCServer(t, store))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "list-request")
+	stream, err := client.ListNotes(ctx, &noterv1.ListNotesRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	header, err := stream.Header()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"list-request"}, header.Get("x-request-id"))
+	assert.Equal(t, "list-request", info.RequestID)
+	store.AssertExpectations(t)
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+	store := new(MockRPCNoteStore)
+
+	client := healthpb.NewHealthClient(startGRPCServer(t, store))
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "noter.v1.NoteService"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+}
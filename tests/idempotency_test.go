@@ -0,0 +1,314 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/middleware"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockIdempotencyStore is a mock implementation of the idempotency store
+type MockIdempotencyStore struct {
+	mock.Mock
+}
+
+// Claim mocks the Claim method
+func (m *MockIdempotencyStore) Claim(ctx context.Context, key string, lease time.Duration) (bool, error) {
+	args := m.Called(ctx, key)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetResponse mocks the GetResponse method
+func (m *MockIdempotencyStore) GetResponse(ctx context.Context, key string) (*models.IdempotentResponse, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdempotentResponse), args.Error(1)
+}
+
+// Complete mocks the Complete method. It runs fn as the repository does in
+// its transaction and hands the response it returns to the expectation,
+// which decides whether storing it succeeds. Like the repository, it stores
+// nothing when fn fails or returns no response.
+func (m *MockIdempotencyStore) Complete(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) (*models.IdempotentResponse, error)) error {
+	resp, err := fn(context.WithValue(ctx, txContextKey{}, true))
+	if err != nil || resp == nil {
+		return err
+	}
+	args := m.Called(ctx, key, resp, ttl)
+	return args.Error(0)
+}
+
+// txContextKey marks the context Complete passes to the request it runs
+type txContextKey struct{}
+
+// Release mocks the Release method
+func (m *MockIdempotencyStore) Release(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+// idempotentHandler wraps a handler creating notes with the idempotency
+// middleware and counts how often it runs
+func idempotentHandler(store *MockIdempotencyStore, calls *int) http.Handler {
+	return middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/notes/1")
+		w.Header().Set("ETag", `"abc"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"title":"Test Note"}`))
+	}))
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/notes", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	return req
+}
+
+// firstResponse runs a request through the handler as the first holder of
+// its key and returns the response it stored
+func firstResponse(handler http.Handler, store *MockIdempotencyStore, req *http.Request) *models.IdempotentResponse {
+	var saved *models.IdempotentResponse
+	key := req.Header.Get(middleware.IdempotencyKeyHeader)
+	store.On("Claim", mock.Anything, key).Return(true, nil).Once()
+	store.On("Complete", mock.Anything, key, mock.Anything, time.Hour).Run(func(args mock.Arguments) {
+		saved = args.Get(2).(*models.IdempotentResponse)
+	}).Return(nil).Once()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return saved
+}
+
+func TestIdempotencyStoresFirstResponse(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	store.On("Claim", mock.Anything, "key-1").Return(true, nil)
+	store.On("Complete", mock.Anything, "key-1", mock.MatchedBy(func(resp *models.IdempotentResponse) bool {
+		return resp.Key == "key-1" && resp.StatusCode == http.StatusCreated &&
+			resp.Headers.Get("Content-Type") == "application/json" && string(resp.Body) == `{"title":"Test Note"}`
+	}), time.Hour).Return(nil)
+
+	var calls int
+	rr := httptest.NewRecorder()
+	idempotentHandler(store, &calls).ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, rr.Header().Get(middleware.IdempotentReplayedHeader))
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "Release", mock.Anything, mock.Anything)
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	var calls int
+	handler := idempotentHandler(store, &calls)
+	saved := firstResponse(handler, store, idempotentRequest("key-1", `{"title":"Test Note"}`))
+	saved.Completed = true
+
+	store.On("Claim", mock.Anything, "key-1").Return(false, nil)
+	store.On("GetResponse", mock.Anything, "key-1").Return(saved, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`))
+
+	// The retry gets the original response without creating a second note
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "/v1/notes/1", rr.Header().Get("Location"))
+	assert.Equal(t, `"abc"`, rr.Header().Get("ETag"))
+	assert.Equal(t, "true", rr.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, `{"title":"Test Note"}`, rr.Body.String())
+}
+
+func TestIdempotencyRejectsReusedKey(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	var calls int
+	handler := idempotentHandler(store, &calls)
+	saved := firstResponse(handler, store, idempotentRequest("key-1", `{"title":"Test Note"}`))
+	saved.Completed = true
+
+	store.On("Claim", mock.Anything, "key-1").Return(false, nil)
+	store.On("GetResponse", mock.Anything, "key-1").Return(saved, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Another Note"}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	var response problem.Problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, problem.CodeIdempotencyKeyReused, response.Code)
+}
+
+func TestIdempotencyFingerprintIncludesQuery(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	var calls int
+	handler := idempotentHandler(store, &calls)
+	req := idempotentRequest("key-1", `{"operations":[]}`)
+	req.URL.RawQuery = "atomic=true"
+	saved := firstResponse(handler, store, req)
+	saved.Completed = true
+
+	store.On("Claim", mock.Anything, "key-1").Return(false, nil)
+	store.On("GetResponse", mock.Anything, "key-1").Return(saved, nil)
+	retry := idempotentRequest("key-1", `{"operations":[]}`)
+	retry.URL.RawQuery = "atomic=false"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, retry)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestIdempotencyWaitsForRequestInProgress(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	var calls int
+	handler := idempotentHandler(store, &calls)
+	saved := firstResponse(handler, store, idempotentRequest("key-1", `{"title":"Test Note"}`))
+	saved.Completed = true
+
+	// The first request is still running when the retry arrives, and has
+	// completed when the retry checks again
+	store.On("Claim", mock.Anything, "key-1").Return(false, nil)
+	store.On("GetResponse", mock.Anything, "key-1").Return(&models.IdempotentResponse{Key: "key-1"}, nil).Once()
+	store.On("GetResponse", mock.Anything, "key-1").Return(saved, nil).Once()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get(middleware.IdempotentReplayedHeader))
+	store.AssertExpectations(t)
+}
+
+func TestIdempotencyTakesOverReleasedKey(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	store.On("Claim", mock.Anything, "key-1").Return(false, nil).Once()
+	store.On("GetResponse", mock.Anything, "key-1").Return(nil, database.ErrNotFound).Once()
+	store.On("Claim", mock.Anything, "key-1").Return(true, nil).Once()
+	store.On("Complete", mock.Anything, "key-1", mock.Anything, time.Hour).Return(nil)
+
+	var calls int
+	rr := httptest.NewRecorder()
+	idempotentHandler(store, &calls).ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	store.AssertExpectations(t)
+}
+
+func TestIdempotencyRejectsRequestStillInProgress(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	store.On("Claim", mock.Anything, "key-1").Return(false, nil)
+	store.On("GetResponse", mock.Anything, "key-1").Return(&models.IdempotentResponse{Key: "key-1"}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	var calls int
+	rr := httptest.NewRecorder()
+	idempotentHandler(store, &calls).ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`).WithContext(ctx))
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var response problem.Problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, problem.CodeIdempotencyKeyInUse, response.Code)
+}
+
+func TestIdempotencyReleasesKeyOnServerError(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	store.On("Claim", mock.Anything, "key-1").Return(true, nil)
+	store.On("Release", mock.Anything, "key-1").Return(nil)
+
+	handler := middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotencyFingerprintsUnreadBody(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	handler := middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Read only the first line, as a streaming handler rejecting it would
+		r.Body.Read(make([]byte, 4))
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	saved := firstResponse(handler, store, idempotentRequest("key-1", "aaaa\nbbbb"))
+	saved.Completed = true
+
+	store.On("Claim", mock.Anything, "key-1").Return(false, nil)
+	store.On("GetResponse", mock.Anything, "key-1").Return(saved, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, idempotentRequest("key-1", "aaaa\ncccc"))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestIdempotencyIgnoresRequestsWithoutKey(t *testing.T) {
+	store := new(MockIdempotencyStore)
+
+	var calls int
+	req := httptest.NewRequest("POST", "/notes", bytes.NewBufferString(`{"title":"Test Note"}`))
+	rr := httptest.NewRecorder()
+	idempotentHandler(store, &calls).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 1, calls)
+	store.AssertNotCalled(t, "Claim", mock.Anything, mock.Anything)
+}
+
+func TestIdempotencyRunsRequestInStoreTransaction(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	store.On("Claim", mock.Anything, "key-1").Return(true, nil)
+	store.On("Complete", mock.Anything, "key-1", mock.Anything, time.Hour).Return(nil)
+
+	// The handler's writes must join the transaction the response is stored in
+	var inTransaction bool
+	handler := middleware.Idempotency(store, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inTransaction, _ = r.Context().Value(txContextKey{}).(bool)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`))
+
+	assert.True(t, inTransaction)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+}
+
+func TestIdempotencyWithholdsResponseWhenStoringFails(t *testing.T) {
+	store := new(MockIdempotencyStore)
+	store.On("Claim", mock.Anything, "key-1").Return(true, nil)
+	store.On("Complete", mock.Anything, "key-1", mock.Anything, time.Hour).Return(errors.New("connection reset"))
+	store.On("Release", mock.Anything, "key-1").Return(nil)
+
+	var calls int
+	rr := httptest.NewRecorder()
+	idempotentHandler(store, &calls).ServeHTTP(rr, idempotentRequest("key-1", `{"title":"Test Note"}`))
+
+	// The note was rolled back with the response, so the client must not
+	// see it created, and may retry with the same key
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	assert.Empty(t, rr.Header().Get("Location"))
+	store.AssertExpectations(t)
+}
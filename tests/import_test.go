@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeImportStore keeps notes in memory and imports them by the rules of
+// the repository: new notes keep their timestamps, and an existing note is
+// only overwritten by a copy edited after it
+type fakeImportStore struct {
+	notes    map[uuid.UUID]*models.Note
+	imported []*models.Note
+	err      error
+}
+
+func newFakeImportStore() *fakeImportStore {
+	return &fakeImportStore{notes: make(map[uuid.UUID]*models.Note)}
+}
+
+// ImportNotes reads every note from next, as COPY does, then upserts them
+func (s *fakeImportStore) ImportNotes(ctx context.Context, next func() (*models.Note, error)) (*database.ImportResult, error) {
+	s.imported = nil
+	for {
+		note, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if note == nil {
+			break
+		}
+		s.imported = append(s.imported, note)
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var result database.ImportResult
+	for _, note := range s.imported {
+		stored, ok := s.notes[note.ID]
+		switch {
+		case !ok:
+			result.Created++
+		case stored.UpdatedAt.Before(note.UpdatedAt):
+			result.Updated++
+		default:
+			result.Unchanged++
+			continue
+		}
+		copied := *note
+		s.notes[note.ID] = &copied
+	}
+	return &result, nil
+}
+
+// ExportNotes calls fn for every note, oldest first
+func (s *fakeImportStore) ExportNotes(ctx context.Context, fn func(*models.Note) error) error {
+	notes := make([]*models.Note, 0, len(s.notes))
+	for _, note := range s.notes {
+		notes = append(notes, note)
+	}
+	slices.SortFunc(notes, func(a, b *models.Note) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	for _, note := range notes {
+		if err := fn(note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamNotes is not used by the NDJSON export
+func (s *fakeImportStore) StreamNotes(ctx context.Context, filter database.NoteFilter, fn func(*models.Note) error) error {
+	return s.ExportNotes(ctx, fn)
+}
+
+func importNDJSON(store handlers.ImportStore, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/import.ndjson", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handlers.NewImportHandler(store).ImportNDJSON(rr, req)
+	return rr
+}
+
+func exportNDJSON(store handlers.ExportStore) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/export.ndjson", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewExportHandler(store).ExportNDJSON(rr, req)
+	return rr
+}
+
+func decodeImportResponse(t *testing.T, rr *httptest.ResponseRecorder) handlers.ImportResponse {
+	var resp handlers.ImportResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestImportNDJSONKeepsIDsAndTimestamps(t *testing.T) {
+	store := newFakeImportStore()
+	body := `{"id":"6f1c1bd4-5c36-4a5e-9d0e-0a3c1f1e2b7d","title":"Kept","created_at":"2026-05-01T12:00:00Z","updated_at":"2026-05-02T08:30:00.5+02:00"}` + "\n" +
+		`{"title":"Defaults","created_at":"2026-05-03T09:00:00Z"}` + "\n"
+
+	rr := importNDJSON(store, body)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	resp := decodeImportResponse(t, rr)
+	assert.Equal(t, 2, resp.Created)
+	assert.Equal(t, 0, resp.Failed)
+	assert.Empty(t, resp.Errors)
+
+	if assert.Len(t, store.imported, 2) {
+		kept := store.imported[0]
+		assert.Equal(t, uuid.MustParse("6f1c1bd4-5c36-4a5e-9d0e-0a3c1f1e2b7d"), kept.ID)
+		assert.Equal(t, "Kept", kept.Title)
+		assert.True(t, kept.CreatedAt.Equal(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)))
+		assert.True(t, kept.UpdatedAt.Equal(time.Date(2026, 5, 2, 6, 30, 0, 500_000_000, time.UTC)))
+
+		defaulted := store.imported[1]
+		assert.NotEqual(t, uuid.Nil, defaulted.ID)
+		assert.True(t, defaulted.UpdatedAt.Equal(defaulted.CreatedAt), "updated_at falls back to created_at")
+	}
+}
+
+func TestImportNDJSONSkipsInvalidLines(t *testing.T) {
+	store := newFakeImportStore()
+	body := strings.Join([]string{
+		`{"title":"First"}`,
+		``,
+		`not json`,
+		`{"id":"nope","title":""}`,
+		`{"title":42}`,
+		`{"title":"Bad date","updated_at":"yesterday"}`,
+		`{"title":"Last"}`,
+	}, "\n")
+
+	rr := importNDJSON(store, body)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	resp := decodeImportResponse(t, rr)
+	assert.Equal(t, 2, resp.Created)
+	assert.Equal(t, 4, resp.Failed)
+	assert.Equal(t, []handlers.ImportLineError{
+		{Line: 3, Field: "note", Message: "must be a JSON object"},
+		{Line: 4, Field: "title", Message: "is required"},
+		{Line: 4, Field: "id", Message: "must be a UUID"},
+		{Line: 5, Field: "title", Message: "has the wrong type"},
+		{Line: 6, Field: "updated_at", Message: "must be an RFC 3339 date-time"},
+	}, resp.Errors)
+	if assert.Len(t, store.imported, 2) {
+		assert.Equal(t, "First", store.imported[0].Title)
+		assert.Equal(t, "Last", store.imported[1].Title)
+	}
+}
+
+func TestImportNDJSONListsAtMostHundredErrors(t *testing.T) {
+	body := strings.Repeat(`{"title":""}`+"\n", 150)
+
+	rr := importNDJSON(newFakeImportStore(), body)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	resp := decodeImportResponse(t, rr)
+	assert.Equal(t, 150, resp.Failed)
+	assert.Len(t, resp.Errors, 100)
+	assert.Equal(t, 100, resp.Errors[99].Line)
+}
+
+func TestImportNDJSONRejectsTooLongLine(t *testing.T) {
+	body := `{"title":"Short"}` + "\n" + `{"title":"` + strings.Repeat("x", 64<<10) + `"}` + "\n"
+
+	rr := importNDJSON(newFakeImportStore(), body)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "Line 2 is longer than 65536 bytes")
+}
+
+func TestImportNDJSONRejectsFutureTimestamps(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := `{"title":"Past","updated_at":"2026-05-02T08:30:00Z","created_at":"2026-05-01T12:00:00Z"}` + "\n" +
+		`{"title":"Skewed","created_at":"` + time.Now().Add(30*time.Second).UTC().Format(time.RFC3339Nano) + `"}` + "\n" +
+		`{"title":"Future","created_at":"2026-05-01T12:00:00Z","updated_at":"` + future + `"}` + "\n"
+	store := newFakeImportStore()
+
+	rr := importNDJSON(store, body)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "Line 3: updated_at is in the future")
+	assert.Empty(t, store.notes, "nothing is imported")
+}
+
+func TestImportNDJSONStoreError(t *testing.T) {
+	store := newFakeImportStore()
+	store.err = errors.New("database unavailable")
+
+	rr := importNDJSON(store, `{"title":"Lost"}`)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+	assert.NotContains(t, rr.Body.String(), "database unavailable")
+}
+
+func TestExportNDJSONWritesOneNotePerLine(t *testing.T) {
+	store := &fakeExportStore{notes: []*models.Note{
+		exportedNote("6f1c1bd4-5c36-4a5e-9d0e-0a3c1f1e2b7d", "First"),
+		exportedNote("0b9e5c3a-1d2f-4e6a-8b7c-9d0e1f2a3b4c", "Second"),
+	}}
+
+	rr := exportNDJSON(store)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.JSONEq(t, `{"id":"6f1c1bd4-5c36-4a5e-9d0e-0a3c1f1e2b7d","title":"First","created_at":"2026-05-01T12:00:00Z","updated_at":"2026-05-02T08:30:00Z"}`, lines[0])
+		assert.JSONEq(t, `{"id":"0b9e5c3a-1d2f-4e6a-8b7c-9d0e1f2a3b4c","title":"Second","created_at":"2026-05-01T12:00:00Z","updated_at":"2026-05-02T08:30:00Z"}`, lines[1])
+	}
+}
+
+func TestImportKeepsEditsMadeSinceLastImport(t *testing.T) {
+	id := uuid.MustParse("6f1c1bd4-5c36-4a5e-9d0e-0a3c1f1e2b7d")
+	source := fmt.Sprintf(`{"id":"%s","title":"Original","created_at":"2026-05-01T12:00:00Z","updated_at":"2026-05-02T08:30:00.123456Z"}`, id)
+	store := newFakeImportStore()
+
+	// The first import creates the note with the source's timestamps
+	resp := decodeImportResponse(t, importNDJSON(store, source))
+	assert.Equal(t, 1, resp.Created)
+
+	// An export carries them unchanged, so importing it back changes nothing
+	exported := exportNDJSON(store).Body.String()
+	resp = decodeImportResponse(t, importNDJSON(store, exported))
+	assert.Equal(t, handlers.ImportResponse{Unchanged: 1, Errors: []handlers.ImportLineError{}}, resp)
+
+	// The note is edited here after it was imported
+	store.notes[id].Title = "Edited here"
+	store.notes[id].UpdatedAt = time.Date(2026, 5, 3, 10, 0, 0, 0, time.UTC)
+
+	// Importing the same source again keeps the edit
+	resp = decodeImportResponse(t, importNDJSON(store, source))
+	assert.Equal(t, 1, resp.Unchanged)
+	assert.Equal(t, "Edited here", store.notes[id].Title)
+
+	// A copy edited at the source after that wins, keeping its own timestamp
+	later := fmt.Sprintf(`{"id":"%s","title":"Edited at the source","updated_at":"2026-05-04T09:00:00Z"}`, id)
+	resp = decodeImportResponse(t, importNDJSON(store, later))
+	assert.Equal(t, 1, resp.Updated)
+	assert.Equal(t, "Edited at the source", store.notes[id].Title)
+	assert.True(t, store.notes[id].UpdatedAt.Equal(time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)))
+
+	// And the final export round-trips exactly
+	scanner := bufio.NewScanner(bytes.NewReader(exportNDJSON(store).Body.Bytes()))
+	assert.True(t, scanner.Scan())
+	var note models.Note
+	assert.NoError(t, json.Unmarshal(scanner.Bytes(), &note))
+	assert.Equal(t, "Edited at the source", note.Title)
+	assert.True(t, note.UpdatedAt.Equal(time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/moabdelazem/noter/internal/jsonpatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396 appendix A
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	}
+
+	for _, tt := range tests {
+		got, err := jsonpatch.MergePatch([]byte(tt.doc), []byte(tt.patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, tt.want, string(got), "%s + %s", tt.doc, tt.patch)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append array element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"baz"}]`, `{"foo":["bar","baz"]}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"copy", `{"foo":{"a":1}}`, `[{"op":"copy","from":"/foo","path":"/bar"}]`, `{"foo":{"a":1},"bar":{"a":1}}`},
+		{"test then replace", `{"title":"old"}`, `[{"op":"test","path":"/title","value":"old"},{"op":"replace","path":"/title","value":"new"}]`, `{"title":"new"}`},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, `{"a/b":3}`},
+		{"numeric test", `{"n":1}`, `[{"op":"test","path":"/n","value":1.0}]`, `{"n":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonpatch.Apply([]byte(tt.doc), []byte(tt.patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestJSONPatchFailedTest(t *testing.T) {
+	doc := []byte(`{"title":"current"}`)
+	_, err := jsonpatch.Apply(doc, []byte(`[{"op":"replace","path":"/title","value":"new"},{"op":"test","path":"/title","value":"stale"}]`))
+
+	assert.ErrorIs(t, err, jsonpatch.ErrTestFailed)
+	// The input document is never modified
+	assert.JSONEq(t, `{"title":"current"}`, string(doc))
+}
+
+func TestJSONPatchInvalid(t *testing.T) {
+	tests := []struct {
+		name, patch string
+	}{
+		{"not an array", `{"op":"add"}`},
+		{"unknown op", `[{"op":"frobnicate","path":"/title"}]`},
+		{"missing path", `[{"op":"remove","path":"/missing"}]`},
+		{"replace missing", `[{"op":"replace","path":"/missing","value":1}]`},
+		{"bad pointer", `[{"op":"add","path":"title","value":1}]`},
+		{"missing value", `[{"op":"add","path":"/x"}]`},
+		{"move into child", `[{"op":"move","from":"/a","path":"/a/b"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsonpatch.Apply([]byte(`{"title":"t","a":{}}`), []byte(tt.patch))
+			assert.ErrorIs(t, err, jsonpatch.ErrInvalidPatch)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/config"
+	"github.com/moabdelazem/noter/internal/events"
+	"github.com/moabdelazem/noter/internal/openapi"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/moabdelazem/noter/internal/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEveryRouteIsInOpenAPISpec fails whenever a route is registered without
+// being described in the OpenAPI document
+func TestEveryRouteIsInOpenAPISpec(t *testing.T) {
+	router := mux.NewRouter()
+	routes.SetupRoutes(router)
+	routes.SetupDBRoutes(router, nil, &config.Config{}, events.NewBroker(10))
+
+	count := 0
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouter prefixes have no methods of their own
+			return nil
+		}
+		for _, method := range methods {
+			count++
+			assert.True(t, openapi.HasOperation(path, method), "%s %s is missing from the OpenAPI spec", method, path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NotZero(t, count)
+}
+
+func TestOpenAPISpecEndpoint(t *testing.T) {
+	router := mux.NewRouter()
+	routes.SetupRoutes(router)
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var document map[string]any
+	err := json.Unmarshal(rr.Body.Bytes(), &document)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.1.0", document["openapi"])
+}
+
+func TestDocsPageLoadsNoThirdPartyCode(t *testing.T) {
+	router := mux.NewRouter()
+	routes.SetupRoutes(router)
+
+	req, _ := http.NewRequest("GET", "/docs", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+
+	// Every script and style is inline, and only the ones shipped with the
+	// page are allowed to run
+	page := rr.Body.String()
+	assert.NotContains(t, page, "<script src")
+	assert.NotContains(t, page, "<link rel=\"stylesheet\"")
+
+	script := regexp.MustCompile(`(?s)<script>(.*?)</script>`).FindStringSubmatch(page)
+	if assert.NotNil(t, script) {
+		sum := sha256.Sum256([]byte(script[1]))
+		csp := rr.Header().Get("Content-Security-Policy")
+		assert.Contains(t, csp, "default-src 'none'")
+		assert.Contains(t, csp, "connect-src 'self'")
+		assert.Contains(t, csp, "script-src 'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+	}
+}
+
+// setupValidatedRouter returns a router with the validator in front of stub note routes
+func setupValidatedRouter(body *[]byte) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(openapi.Validator)
+	router.HandleFunc("/notes", func(w http.ResponseWriter, r *http.Request) {
+		*body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}).Methods("POST")
+	router.HandleFunc("/notes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	return router
+}
+
+func TestValidatorPassesValidRequest(t *testing.T) {
+	var body []byte
+	router := setupValidatedRouter(&body)
+
+	req, _ := http.NewRequest("POST", "/notes", bytes.NewBufferString(`{"title": "Test Note"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	// The handler still sees the original body
+	assert.JSONEq(t, `{"title": "Test Note"}`, string(body))
+}
+
+func TestValidatorRejectsInvalidBody(t *testing.T) {
+	var body []byte
+	router := setupValidatedRouter(&body)
+
+	tests := []struct {
+		name     string
+		body     string
+		location string
+	}{
+		{"missing title", `{}`, "body.title"},
+		{"empty title", `{"title": ""}`, "body.title"},
+		{"wrong type", `{"title": 123}`, "body.title"},
+		{"not an object", `[]`, "body"},
+		{"malformed JSON", `{"title":`, "body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/notes", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+
+			var response problem.Problem
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			if assert.Len(t, response.Errors, 1) {
+				assert.Equal(t, tt.location, response.Errors[0].Field)
+			}
+		})
+	}
+}
+
+func TestValidatorRejectsUnsupportedContentType(t *testing.T) {
+	var body []byte
+	router := setupValidatedRouter(&body)
+
+	req, _ := http.NewRequest("POST", "/notes", bytes.NewBufferString(`title=Test`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+}
+
+func TestValidatorRejectsInvalidPathParameter(t *testing.T) {
+	var body []byte
+	router := setupValidatedRouter(&body)
+
+	req, _ := http.NewRequest("GET", "/notes/invalid-id", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var response problem.Problem
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	if assert.Len(t, response.Errors, 1) {
+		assert.Equal(t, "path.id", response.Errors[0].Field)
+	}
+}
+
+func TestValidatorStreamsNDJSONBodies(t *testing.T) {
+	var received int64
+	router := mux.NewRouter()
+	router.Use(openapi.Validator)
+	router.HandleFunc("/import.ndjson", func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	// Larger than the validator would ever buffer
+	body := bytes.Repeat([]byte(`{"title":"Test Note"}`+"\n"), 100000)
+	req, _ := http.NewRequest("POST", "/import.ndjson", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(len(body)), received)
+}
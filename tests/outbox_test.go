@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/outbox"
+	"github.com/moabdelazem/noter/internal/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeOutboxStore hands its messages to the dispatcher and records what
+// became of each
+type fakeOutboxStore struct {
+	messages []*models.OutboxMessage
+	errs     map[int64]error
+	backoff  func(attempts int) time.Duration
+}
+
+// Dispatch delivers every message, as the repository does for due ones
+func (s *fakeOutboxStore) Dispatch(ctx context.Context, limit int, deliver func(ctx context.Context, msg *models.OutboxMessage) error, backoff func(attempts int) time.Duration) (int, error) {
+	s.errs = make(map[int64]error)
+	s.backoff = backoff
+	for _, msg := range s.messages {
+		s.errs[msg.ID] = deliver(ctx, msg)
+	}
+	return len(s.messages), nil
+}
+
+// PurgeDispatched does nothing
+func (s *fakeOutboxStore) PurgeDispatched(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func outboxMessage(id int64) *models.OutboxMessage {
+	return &models.OutboxMessage{
+		ID:        id,
+		EventID:   id + 100,
+		NoteID:    uuid.New(),
+		EventType: "note.updated",
+		Payload:   json.RawMessage(`{"id":1}`),
+	}
+}
+
+func TestDispatcherDeliversToEverySinkInOrder(t *testing.T) {
+	store := &fakeOutboxStore{messages: []*models.OutboxMessage{outboxMessage(1), outboxMessage(2)}}
+	var delivered []string
+	sink := func(name string) outbox.Sink {
+		return outbox.SinkFunc(func(ctx context.Context, msg *models.OutboxMessage) error {
+			delivered = append(delivered, name+":"+msg.EventType)
+			return nil
+		})
+	}
+
+	claimed, err := outbox.NewDispatcher(store, sink("first"), sink("second")).DispatchPending(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, claimed)
+	assert.Equal(t, []string{"first:note.updated", "second:note.updated", "first:note.updated", "second:note.updated"}, delivered)
+	assert.NoError(t, store.errs[1])
+	assert.NoError(t, store.errs[2])
+	assert.NotNil(t, store.backoff)
+}
+
+func TestDispatcherStopsAtFailingSink(t *testing.T) {
+	store := &fakeOutboxStore{messages: []*models.OutboxMessage{outboxMessage(1)}}
+	failing := outbox.SinkFunc(func(ctx context.Context, msg *models.OutboxMessage) error {
+		return errors.New("sink unavailable")
+	})
+	called := false
+	later := outbox.SinkFunc(func(ctx context.Context, msg *models.OutboxMessage) error {
+		called = true
+		return nil
+	})
+
+	_, err := outbox.NewDispatcher(store, failing, later).DispatchPending(context.Background())
+
+	assert.NoError(t, err)
+	assert.ErrorContains(t, store.errs[1], "sink unavailable")
+	assert.False(t, called)
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, outbox.Backoff(1))
+	assert.Equal(t, 4*time.Second, outbox.Backoff(3))
+	assert.Equal(t, 5*time.Minute, outbox.Backoff(100))
+}
+
+// MockEnqueuer is a mock implementation of the webhook delivery enqueuer
+type MockEnqueuer struct {
+	mock.Mock
+}
+
+// EnqueueDeliveries mocks the EnqueueDeliveries method
+func (m *MockEnqueuer) EnqueueDeliveries(ctx context.Context, eventID int64, eventType string, payload json.RawMessage) error {
+	args := m.Called(ctx, eventID, eventType, payload)
+	return args.Error(0)
+}
+
+func TestWebhookSinkEnqueuesDeliveries(t *testing.T) {
+	enqueuer := new(MockEnqueuer)
+	msg := outboxMessage(1)
+	enqueuer.On("EnqueueDeliveries", mock.Anything, int64(101), "note.updated", msg.Payload).Return(nil)
+
+	err := webhooks.NewSink(enqueuer).Deliver(context.Background(), msg)
+
+	assert.NoError(t, err)
+	enqueuer.AssertExpectations(t)
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/jsonpatch"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// patchNote sends a PATCH of the note with the given content type and body
+// to the handler, which finds the note in the store
+func patchNote(note *models.Note, contentType, body string) (*MockHandlerNoteStore, *httptest.ResponseRecorder) {
+	store := new(MockHandlerNoteStore)
+	store.On("UpdateNote", mock.Anything, note.ID).Return(note, nil)
+
+	req := httptest.NewRequest("PATCH", "/notes/"+note.ID.String(), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	req = mux.SetURLVars(req, map[string]string{"id": note.ID.String()})
+	rr := httptest.NewRecorder()
+	handlers.NewNoteHandler(store, handlers.V1Presenter{}, 100).PatchNote(rr, req)
+	return store, rr
+}
+
+// decodeProblem decodes the problem details of a response
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) problem.Problem {
+	var p problem.Problem
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	return p
+}
+
+func TestPatchNoteWithMergePatch(t *testing.T) {
+	note := models.NewNote("Old Title")
+	_, rr := patchNote(note, jsonpatch.MergePatchType, `{"title":"New Title"}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var updated models.Note
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&updated))
+	assert.Equal(t, "New Title", updated.Title)
+	assert.Equal(t, note.ID, updated.ID)
+}
+
+func TestPatchNoteWithJSONPatch(t *testing.T) {
+	note := models.NewNote("Old Title")
+	body := `[{"op":"test","path":"/title","value":"Old Title"},{"op":"replace","path":"/title","value":"New Title"}]`
+	_, rr := patchNote(note, jsonpatch.JSONPatchType, body)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var updated models.Note
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&updated))
+	assert.Equal(t, "New Title", updated.Title)
+}
+
+func TestPatchNoteRejectsUnsupportedContentType(t *testing.T) {
+	note := models.NewNote("Old Title")
+	store, rr := patchNote(note, "application/json", `{"title":"New Title"}`)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.Equal(t, problem.CodeUnsupportedMediaType, decodeProblem(t, rr).Code)
+	store.AssertNotCalled(t, "UpdateNote", mock.Anything, mock.Anything)
+}
+
+func TestPatchNoteFailedTestIsAConflict(t *testing.T) {
+	note := models.NewNote("Old Title")
+	body := `[{"op":"test","path":"/title","value":"Another Title"},{"op":"replace","path":"/title","value":"New Title"}]`
+	_, rr := patchNote(note, jsonpatch.JSONPatchType, body)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, problem.CodePatchTestFailed, decodeProblem(t, rr).Code)
+}
+
+func TestPatchNoteRejectsInvalidPatch(t *testing.T) {
+	note := models.NewNote("Old Title")
+	_, rr := patchNote(note, jsonpatch.JSONPatchType, `[{"op":"move","path":"/title"}]`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, problem.CodeInvalidPatch, decodeProblem(t, rr).Code)
+}
+
+func TestPatchNoteRejectsReadOnlyFields(t *testing.T) {
+	note := models.NewNote("Old Title")
+	body := `{"id":"00000000-0000-0000-0000-000000000001","created_at":"2020-01-01T00:00:00Z"}`
+	_, rr := patchNote(note, jsonpatch.MergePatchType, body)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	p := decodeProblem(t, rr)
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+	assert.Equal(t, []database.FieldError{
+		{Field: "id", Message: "is read-only"},
+		{Field: "created_at", Message: "is read-only"},
+	}, p.Errors)
+}
+
+func TestPatchNoteRejectsUnknownFields(t *testing.T) {
+	note := models.NewNote("Old Title")
+	_, rr := patchNote(note, jsonpatch.JSONPatchType, `[{"op":"add","path":"/color","value":"red"}]`)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, []database.FieldError{{Field: "color", Message: "is not allowed"}}, decodeProblem(t, rr).Errors)
+}
+
+func TestPatchNoteMergePatchNull(t *testing.T) {
+	note := models.NewNote("Old Title")
+
+	// null removes a member, and the title is required
+	_, rr := patchNote(note, jsonpatch.MergePatchType, `{"title":null}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, []database.FieldError{{Field: "title", Message: "is required"}}, decodeProblem(t, rr).Errors)
+
+	// Removing a member the note does not have changes nothing
+	_, rr = patchNote(note, jsonpatch.MergePatchType, `{"color":null}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var updated models.Note
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&updated))
+	assert.Equal(t, "Old Title", updated.Title)
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moabdelazem/noter/internal/audit"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/stretchr/testify/assert"
+)
+
+// renderError runs problem.Error for err and decodes the response
+func renderError(t *testing.T, err error) (*httptest.ResponseRecorder, problem.Problem) {
+	req := httptest.NewRequest("GET", "/notes/123", nil)
+	req = req.WithContext(audit.NewContext(req.Context(), audit.Info{RequestID: "req-1"}))
+	rr := httptest.NewRecorder()
+	problem.Error(rr, req, err)
+
+	var response problem.Problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return rr, response
+}
+
+func TestProblemForNotFound(t *testing.T) {
+	rr, response := renderError(t, fmt.Errorf("failed to get note by ID: %w", database.ErrNotFound))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	assert.Equal(t, problem.CodeNotFound, response.Code)
+	assert.Equal(t, http.StatusNotFound, response.Status)
+	assert.Equal(t, "/notes/123", response.Instance)
+	assert.Equal(t, "req-1", response.RequestID)
+}
+
+func TestProblemForValidationError(t *testing.T) {
+	err := fmt.Errorf("failed to create note: %w", &database.ValidationError{
+		Fields: []database.FieldError{{Field: "title", Message: "is too long"}},
+	})
+	rr, response := renderError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, problem.CodeValidationFailed, response.Code)
+	assert.Equal(t, []database.FieldError{{Field: "title", Message: "is too long"}}, response.Errors)
+}
+
+func TestProblemForConflict(t *testing.T) {
+	rr, response := renderError(t, fmt.Errorf("failed to create note: %w", database.ErrConflict))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, problem.CodeConflict, response.Code)
+}
+
+func TestProblemHidesInternalErrors(t *testing.T) {
+	rr, response := renderError(t, fmt.Errorf("failed to get note by ID: connection refused"))
+
+	// A database outage must not look like a missing note, nor leak its cause
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, problem.CodeInternal, response.Code)
+	assert.NotContains(t, rr.Body.String(), "connection refused")
+	assert.Equal(t, "req-1", response.RequestID)
+}
+
+func TestProblemForAbortedBatchOperation(t *testing.T) {
+	rr, response := renderError(t, database.ErrBatchAborted)
+
+	assert.Equal(t, http.StatusFailedDependency, rr.Code)
+	assert.Equal(t, problem.CodeBatchAborted, response.Code)
+}
+
+func TestUnknownPathIsProblem(t *testing.T) {
+	router := setupVersionedRouter()
+
+	for _, path := range []string{"/nope", "/v1/nope", "/v1/notes/1/extra"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code, path)
+		assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+		var response problem.Problem
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, problem.CodeNotFound, response.Code)
+		assert.Equal(t, path, response.Instance)
+		assert.NotEmpty(t, response.RequestID)
+	}
+}
+
+func TestWrongMethodIsProblem(t *testing.T) {
+	router := setupVersionedRouter()
+
+	for request, allow := range map[string]string{
+		"DELETE /v1/notes": "GET, POST",
+		"PUT /health":      "GET",
+	} {
+		method, path, _ := strings.Cut(request, " ")
+		req, _ := http.NewRequest(method, path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code, request)
+		assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+		assert.Equal(t, allow, rr.Header().Get("Allow"))
+		var response problem.Problem
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, problem.CodeMethodNotAllowed, response.Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, response.Status)
+		assert.NotEmpty(t, response.RequestID)
+	}
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	offered := []string{"application/json", "text/markdown", "text/html", "text/plain"}
+
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"missing header", "", "application/json", true},
+		{"exact match", "text/markdown", "text/markdown", true},
+		{"anything", "*/*", "application/json", true},
+		{"type wildcard", "text/*", "text/markdown", true},
+		{"quality order", "text/plain;q=0.5, text/html", "text/html", true},
+		{"specific range wins", "text/*;q=0.9, text/plain;q=0.1, text/html;q=0.2", "text/markdown", true},
+		{"excluded type", "application/json;q=0, */*", "text/markdown", true},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html", true},
+		{"unsupported", "application/pdf", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaType, ok := handlers.NegotiateMediaType(tt.accept, offered)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, mediaType)
+		})
+	}
+}
+
+// renderedNote is the note the renderer tests serve
+func renderedNote() *models.Note {
+	return &models.Note{
+		ID:        uuid.MustParse("6f1c2a4e-8b3d-4f5a-9c7e-1d2b3a4c5e6f"),
+		Title:     "Groceries & <chores>",
+		CreatedAt: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2026, 5, 2, 8, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestGetNoteRenderers(t *testing.T) {
+	note := renderedNote()
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{
+			"application/json",
+			"application/json",
+			`{"id":"6f1c2a4e-8b3d-4f5a-9c7e-1d2b3a4c5e6f","title":"Groceries \u0026 \u003cchores\u003e","created_at":"2026-05-01T12:00:00Z","updated_at":"2026-05-02T08:30:00Z"}` + "\n",
+		},
+		{
+			"text/markdown",
+			"text/markdown; charset=utf-8",
+			"---\nid: 6f1c2a4e-8b3d-4f5a-9c7e-1d2b3a4c5e6f\ntitle: \"Groceries \\u0026 \\u003cchores\\u003e\"\ncreated_at: 2026-05-01T12:00:00Z\nupdated_at: 2026-05-02T08:30:00Z\n---\n\n# Groceries \\& \\<chores\\>\n",
+		},
+		{
+			"text/plain",
+			"text/plain; charset=utf-8",
+			"Groceries & <chores>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			store := new(MockHandlerNoteStore)
+			store.On("GetNoteByID", mock.Anything, note.ID).Return(note, nil)
+
+			rr := getNote(store, note.ID, http.Header{"Accept": {tt.accept}})
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+			assert.Equal(t, tt.body, rr.Body.String())
+		})
+	}
+}
+
+func TestGetNoteRendersEscapedHTML(t *testing.T) {
+	note := renderedNote()
+	store := new(MockHandlerNoteStore)
+	store.On("GetNoteByID", mock.Anything, note.ID).Return(note, nil)
+
+	rr := getNote(store, note.ID, http.Header{"Accept": {"text/html"}})
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	body := rr.Body.String()
+	assert.True(t, strings.HasPrefix(body, "<!DOCTYPE html>"))
+	assert.Contains(t, body, "<title>Groceries &amp; &lt;chores&gt;</title>")
+	assert.Contains(t, body, "<h1>Groceries &amp; &lt;chores&gt;</h1>")
+	assert.Contains(t, body, `<time datetime="2026-05-02T08:30:00Z">2026-05-02 08:30 UTC</time>`)
+	assert.NotContains(t, body, "<chores>")
+}
+
+func TestGetNoteNotAcceptable(t *testing.T) {
+	note := renderedNote()
+	store := new(MockHandlerNoteStore)
+
+	rr := getNote(store, note.ID, http.Header{"Accept": {"application/pdf, image/*"}})
+
+	assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+	assert.Equal(t, "Accept", rr.Header().Get("Vary"))
+	assert.Equal(t, problem.CodeNotAcceptable, decodeProblem(t, rr).Code)
+	store.AssertNotCalled(t, "GetNoteByID", mock.Anything, mock.Anything)
+}
+
+func TestRegisteredRendererIsNegotiated(t *testing.T) {
+	handlers.RegisterNoteRenderer("application/vnd.noter.title", handlers.RendererFunc(func(w io.Writer, note *models.Note, _ handlers.Presenter) error {
+		_, err := io.WriteString(w, strings.ToUpper(note.Title))
+		return err
+	}))
+	note := renderedNote()
+	store := new(MockHandlerNoteStore)
+	store.On("GetNoteByID", mock.Anything, note.ID).Return(note, nil)
+
+	rr := getNote(store, note.ID, http.Header{"Accept": {"application/vnd.noter.title"}})
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/vnd.noter.title", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "GROCERIES & <CHORES>", rr.Body.String())
+}
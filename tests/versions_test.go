@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/config"
+	"github.com/moabdelazem/noter/internal/events"
+	"github.com/moabdelazem/noter/internal/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupVersionedRouter returns a router with every route registered. The
+// requests made against it must not reach the database.
+func setupVersionedRouter() *mux.Router {
+	router := mux.NewRouter()
+	routes.SetupRoutes(router)
+	routes.SetupDBRoutes(router, nil, &config.Config{}, events.NewBroker(10))
+	return router
+}
+
+func TestVersionedRoutesAreNotDeprecated(t *testing.T) {
+	router := setupVersionedRouter()
+
+	req, _ := http.NewRequest("GET", "/v1/notes/not-a-uuid", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Empty(t, rr.Header().Get("Deprecation"))
+	assert.Empty(t, rr.Header().Get("Sunset"))
+}
+
+func TestUnversionedRoutesAreDeprecatedAliases(t *testing.T) {
+	router := setupVersionedRouter()
+
+	req, _ := http.NewRequest("GET", "/notes/not-a-uuid", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	// The alias behaves like the v1 route, with deprecation headers on top
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Regexp(t, `^@\d+$`, rr.Header().Get("Deprecation"))
+	assert.NotEmpty(t, rr.Header().Get("Sunset"))
+	assert.Equal(t, `</v1/notes/not-a-uuid>; rel="successor-version"`, rr.Header().Get("Link"))
+}
+
+func TestOperationalRoutesStayUnversioned(t *testing.T) {
+	router := setupVersionedRouter()
+
+	req, _ := http.NewRequest("GET", "/health", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Deprecation"))
+}
+
+func TestOnlyPreVersioningRoutesHaveUnversionedAliases(t *testing.T) {
+	router := setupVersionedRouter()
+
+	// Routes added after /v1 was introduced were never unversioned, so they
+	// must not ship as deprecated aliases
+	for _, request := range []string{
+		"POST /notes/batch",
+		"PATCH /notes/00000000-0000-0000-0000-000000000001",
+		"GET /audit",
+		"GET /webhooks",
+		"GET /export/markdown",
+		"GET /export.ndjson",
+		"POST /import.ndjson",
+		"POST /graphql",
+	} {
+		method, path, _ := strings.Cut(request, " ")
+		var match mux.RouteMatch
+		req, _ := http.NewRequest(method, path, nil)
+		matched := router.Match(req, &match) && match.MatchErr == nil
+		assert.False(t, matched, "%s has an unversioned alias", request)
+	}
+
+	// /notes/events is only the alias of /v1/notes/{id}, which rejects the ID
+	req, _ := http.NewRequest("GET", "/notes/events", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+}
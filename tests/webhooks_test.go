@@ -0,0 +1,552 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/moabdelazem/noter/internal/database"
+	"github.com/moabdelazem/noter/internal/handlers"
+	"github.com/moabdelazem/noter/internal/models"
+	"github.com/moabdelazem/noter/internal/problem"
+	"github.com/moabdelazem/noter/internal/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// MockWebhookStore is a mock implementation of the webhook delivery store
+type MockWebhookStore struct {
+	mock.Mock
+}
+
+// ClaimDueDeliveries mocks the ClaimDueDeliveries method
+func (m *MockWebhookStore) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*database.ClaimedDelivery, error) {
+	args := m.Called(ctx, limit, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*database.ClaimedDelivery), args.Error(1)
+}
+
+// RecordAttempt mocks the RecordAttempt method
+func (m *MockWebhookStore) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt database.DeliveryAttempt) error {
+	args := m.Called(ctx, delivery, attempt)
+	return args.Error(0)
+}
+
+// claimedDelivery builds a due delivery of a note.created event to url
+func claimedDelivery(url string, attempts int) *database.ClaimedDelivery {
+	return &database.ClaimedDelivery{
+		Delivery: &models.WebhookDelivery{
+			ID:        42,
+			WebhookID: uuid.New(),
+			EventID:   7,
+			EventType: "note.created",
+			Payload:   json.RawMessage(`{"id":7,"type":"note.created"}`),
+			Status:    models.DeliveryPending,
+			Attempts:  attempts,
+		},
+		URL:    url,
+		Secret: testWebhookSecret,
+	}
+}
+
+// loopbackNetworks allows deliveries to the httptest receivers
+var loopbackNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+// deliverOnce runs a single worker pass over one claimed delivery, allowing
+// loopback destinations, and returns the attempt it recorded
+func deliverOnce(t *testing.T, claimed *database.ClaimedDelivery) database.DeliveryAttempt {
+	return deliverOnceTo(t, claimed, loopbackNetworks)
+}
+
+// deliverOnceTo runs a single worker pass over one claimed delivery with
+// the given allowed networks and returns the attempt it recorded
+func deliverOnceTo(t *testing.T, claimed *database.ClaimedDelivery, allowedNetworks []netip.Prefix) database.DeliveryAttempt {
+	store := new(MockWebhookStore)
+	store.On("ClaimDueDeliveries", mock.Anything, mock.Anything, mock.Anything).Return([]*database.ClaimedDelivery{claimed}, nil)
+	var recorded database.DeliveryAttempt
+	store.On("RecordAttempt", mock.Anything, claimed.Delivery, mock.Anything).Run(func(args mock.Arguments) {
+		recorded = args.Get(2).(database.DeliveryAttempt)
+	}).Return(nil)
+
+	err := webhooks.NewWorker(store, allowedNetworks).DeliverDue(context.Background())
+	assert.NoError(t, err)
+	store.AssertExpectations(t)
+	return recorded
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	attempt := deliverOnce(t, claimedDelivery(receiver.URL, 0))
+
+	assert.True(t, attempt.Succeeded)
+	assert.Equal(t, http.StatusNoContent, attempt.StatusCode)
+	assert.Nil(t, attempt.RetryAt)
+
+	assert.Equal(t, "POST", received.Method)
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.Equal(t, "note.created", received.Header.Get(webhooks.EventHeader))
+	assert.Equal(t, "42", received.Header.Get(webhooks.DeliveryHeader))
+	assert.JSONEq(t, `{"id":7,"type":"note.created"}`, string(body))
+	assert.NoError(t, webhooks.Verify(testWebhookSecret, received.Header, body, 5*time.Minute))
+	assert.ErrorIs(t, webhooks.Verify("another secret", received.Header, body, 5*time.Minute), webhooks.ErrInvalidSignature)
+}
+
+func TestFailedWebhookDeliveryIsRetried(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	before := time.Now()
+	attempt := deliverOnce(t, claimedDelivery(receiver.URL, 0))
+
+	assert.False(t, attempt.Succeeded)
+	assert.Equal(t, http.StatusInternalServerError, attempt.StatusCode)
+	assert.Contains(t, attempt.Error, "500")
+	assert.Equal(t, webhooks.DisableAfter, attempt.DisableAfter)
+	if assert.NotNil(t, attempt.RetryAt) {
+		assert.WithinRange(t, *attempt.RetryAt, before.Add(15*time.Second), time.Now().Add(30*time.Second))
+	}
+}
+
+func TestUnreachableWebhookIsRetried(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	receiver.Close()
+
+	attempt := deliverOnce(t, claimedDelivery(receiver.URL, 0))
+
+	assert.False(t, attempt.Succeeded)
+	assert.Zero(t, attempt.StatusCode)
+	assert.NotEmpty(t, attempt.Error)
+	assert.NotNil(t, attempt.RetryAt)
+}
+
+func TestWebhookRedirectIsAFailure(t *testing.T) {
+	receiver := httptest.NewServer(http.RedirectHandler("https://example.com", http.StatusFound))
+	defer receiver.Close()
+
+	attempt := deliverOnce(t, claimedDelivery(receiver.URL, 0))
+
+	assert.False(t, attempt.Succeeded)
+	assert.Equal(t, http.StatusFound, attempt.StatusCode)
+}
+
+func TestWebhookDeliveryGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	attempt := deliverOnce(t, claimedDelivery(receiver.URL, webhooks.MaxAttempts-1))
+
+	assert.False(t, attempt.Succeeded)
+	assert.Nil(t, attempt.RetryAt)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		first := webhooks.Backoff(1)
+		assert.GreaterOrEqual(t, first, 15*time.Second)
+		assert.Less(t, first, 30*time.Second)
+
+		third := webhooks.Backoff(3)
+		assert.GreaterOrEqual(t, third, time.Minute)
+		assert.Less(t, third, 2*time.Minute)
+
+		capped := webhooks.Backoff(50)
+		assert.GreaterOrEqual(t, capped, 30*time.Minute)
+		assert.Less(t, capped, time.Hour)
+	}
+}
+
+func TestVerifyRejectsStaleDeliveries(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	sentAt := time.Now().Add(-10 * time.Minute)
+	header := http.Header{}
+	header.Set(webhooks.TimestampHeader, "0")
+	header.Set(webhooks.SignatureHeader, webhooks.Sign(testWebhookSecret, sentAt, body))
+	assert.ErrorIs(t, webhooks.Verify(testWebhookSecret, header, body, 5*time.Minute), webhooks.ErrInvalidSignature)
+
+	header.Set(webhooks.TimestampHeader, strconv.FormatInt(sentAt.Unix(), 10))
+	assert.ErrorIs(t, webhooks.Verify(testWebhookSecret, header, body, 5*time.Minute), webhooks.ErrInvalidSignature)
+	assert.NoError(t, webhooks.Verify(testWebhookSecret, header, body, 15*time.Minute))
+
+	assert.ErrorIs(t, webhooks.Verify(testWebhookSecret, header, []byte(`{"id":2}`), 15*time.Minute), webhooks.ErrInvalidSignature)
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	handler := handlers.NewWebhookHandler(nil, nil)
+
+	body := `{"url":"ftp://example.com/hook","event_types":["note.created","note.archived"]}`
+	req := httptest.NewRequest("POST", "/webhooks", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handler.CreateWebhook(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var p problem.Problem
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+	assert.Equal(t, []database.FieldError{
+		{Field: "url", Message: "must be an absolute http or https URL"},
+		{Field: "event_types[1]", Message: "is not a known event type"},
+	}, p.Errors)
+}
+
+func TestWebhookDeliveryToPrivateAddressIsRefused(t *testing.T) {
+	var received bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+
+	// Host names are checked against the address they resolve to
+	url := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+	attempt := deliverOnceTo(t, claimedDelivery(url, 0), nil)
+
+	assert.False(t, received)
+	assert.False(t, attempt.Succeeded)
+	assert.Zero(t, attempt.StatusCode)
+	// The delivery log does not say what the host resolved to or whether
+	// anything listens there
+	assert.Equal(t, webhooks.ErrDestinationNotAllowed.Error(), attempt.Error)
+}
+
+func TestAllowedWebhookDestinations(t *testing.T) {
+	for addr, allowed := range map[string]bool{
+		"93.184.215.14":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"255.255.255.255":  false,
+		"224.0.0.1":        false,
+		"::ffff:127.0.0.1": false,
+		"::ffff:10.0.0.1":  false,
+		"64:ff9b::a00:1":   false,
+	} {
+		assert.Equal(t, allowed, webhooks.AllowedDestination(netip.MustParseAddr(addr), nil), addr)
+	}
+
+	// An allowed network opens up exactly the addresses it contains
+	internal := []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}
+	assert.True(t, webhooks.AllowedDestination(netip.MustParseAddr("10.1.2.3"), internal))
+	assert.False(t, webhooks.AllowedDestination(netip.MustParseAddr("10.2.0.1"), internal))
+}
+
+func TestCreateWebhookRejectsPrivateDestinations(t *testing.T) {
+	handler := handlers.NewWebhookHandler(nil, nil)
+
+	for _, url := range []string{
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://localhost:8080/hook",
+		"http://api.localhost/hook",
+	} {
+		body := `{"url":"` + url + `","event_types":["note.created"]}`
+		req := httptest.NewRequest("POST", "/webhooks", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handler.CreateWebhook(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+		var p problem.Problem
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+		assert.Equal(t, []database.FieldError{
+			{Field: "url", Message: "must not point to a private, loopback or link-local address"},
+		}, p.Errors, url)
+	}
+}
+
+// MockHandlerWebhookStore is a mock implementation of handlers.WebhookStore
+type MockHandlerWebhookStore struct {
+	mock.Mock
+}
+
+// CreateWebhook mocks the CreateWebhook method
+func (m *MockHandlerWebhookStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	args := m.Called(ctx, webhook)
+	return args.Error(0)
+}
+
+// ListWebhooks mocks the ListWebhooks method
+func (m *MockHandlerWebhookStore) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Webhook), args.Error(1)
+}
+
+// GetWebhook mocks the GetWebhook method
+func (m *MockHandlerWebhookStore) GetWebhook(ctx context.Context, id uuid.UUID) (*models.Webhook, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+// UpdateWebhook mocks the UpdateWebhook method
+func (m *MockHandlerWebhookStore) UpdateWebhook(ctx context.Context, id uuid.UUID, update database.WebhookUpdate) (*models.Webhook, error) {
+	args := m.Called(ctx, id, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+// DeleteWebhook mocks the DeleteWebhook method
+func (m *MockHandlerWebhookStore) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// ListDeliveries mocks the ListDeliveries method
+func (m *MockHandlerWebhookStore) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]*models.WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+// Redeliver mocks the Redeliver method
+func (m *MockHandlerWebhookStore) Redeliver(ctx context.Context, webhookID uuid.UUID, deliveryID int64) (*models.WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, deliveryID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+// storedWebhook builds an active webhook as the store returns it
+func storedWebhook() *models.Webhook {
+	return &models.Webhook{
+		ID:         uuid.New(),
+		URL:        "https://example.com/hook",
+		EventTypes: []string{"note.created"},
+		Secret:     testWebhookSecret,
+		Active:     true,
+	}
+}
+
+// webhookRequest builds a request to a webhook route with its path variables set
+func webhookRequest(method, body string, vars map[string]string) *http.Request {
+	req := httptest.NewRequest(method, "/webhooks", strings.NewReader(body))
+	return mux.SetURLVars(req, vars)
+}
+
+func TestCreateWebhookGeneratesSecret(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	var created *models.Webhook
+	store.On("CreateWebhook", AnyContext(), mock.Anything).Run(func(args mock.Arguments) {
+		created = args.Get(1).(*models.Webhook)
+	}).Return(nil)
+
+	rr := httptest.NewRecorder()
+	body := `{"url":"https://example.com/hook","event_types":["note.created"]}`
+	handlers.NewWebhookHandler(store, nil).CreateWebhook(rr, webhookRequest("POST", body, nil))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var resp map[string]any
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+	assert.Equal(t, created.Secret, resp["secret"])
+	assert.Equal(t, true, resp["active"])
+	store.AssertExpectations(t)
+}
+
+func TestCreateWebhookRejectsShortSecret(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+
+	rr := httptest.NewRecorder()
+	body := `{"url":"https://example.com/hook","event_types":["note.created"],"secret":"short"}`
+	handlers.NewWebhookHandler(store, nil).CreateWebhook(rr, webhookRequest("POST", body, nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var p problem.Problem
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, []database.FieldError{{Field: "secret", Message: "must be at least 32 bytes"}}, p.Errors)
+	store.AssertNotCalled(t, "CreateWebhook", mock.Anything, mock.Anything)
+}
+
+func TestCreateWebhookKeepsGivenSecret(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	secret := strings.Repeat("s", 32)
+	store.On("CreateWebhook", AnyContext(), mock.MatchedBy(func(webhook *models.Webhook) bool {
+		return webhook.Secret == secret
+	})).Return(nil)
+
+	rr := httptest.NewRecorder()
+	body := `{"url":"https://example.com/hook","event_types":["note.created"],"secret":"` + secret + `"}`
+	handlers.NewWebhookHandler(store, nil).CreateWebhook(rr, webhookRequest("POST", body, nil))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	store.AssertExpectations(t)
+}
+
+func TestListWebhooksHidesSecrets(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	webhook := storedWebhook()
+	store.On("ListWebhooks", AnyContext()).Return([]*models.Webhook{webhook}, nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewWebhookHandler(store, nil).ListWebhooks(rr, webhookRequest("GET", "", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), webhook.ID.String())
+	assert.NotContains(t, rr.Body.String(), testWebhookSecret)
+}
+
+func TestGetWebhook(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	webhook := storedWebhook()
+	store.On("GetWebhook", AnyContext(), webhook.ID).Return(webhook, nil)
+	missing := uuid.New()
+	store.On("GetWebhook", AnyContext(), missing).Return(nil, database.ErrNotFound)
+	handler := handlers.NewWebhookHandler(store, nil)
+
+	rr := httptest.NewRecorder()
+	handler.GetWebhook(rr, webhookRequest("GET", "", map[string]string{"id": webhook.ID.String()}))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var got models.Webhook
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, webhook.URL, got.URL)
+
+	rr = httptest.NewRecorder()
+	handler.GetWebhook(rr, webhookRequest("GET", "", map[string]string{"id": missing.String()}))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.GetWebhook(rr, webhookRequest("GET", "", map[string]string{"id": "nope"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUpdateWebhook(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	webhook := storedWebhook()
+	active := false
+	store.On("UpdateWebhook", AnyContext(), webhook.ID, database.WebhookUpdate{Active: &active}).Return(webhook, nil)
+	handler := handlers.NewWebhookHandler(store, nil)
+
+	rr := httptest.NewRecorder()
+	handler.UpdateWebhook(rr, webhookRequest("PATCH", `{"active":false}`, map[string]string{"id": webhook.ID.String()}))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	store.AssertExpectations(t)
+
+	rr = httptest.NewRecorder()
+	handler.UpdateWebhook(rr, webhookRequest("PATCH", `{"url":"http://10.0.0.1/hook"}`, map[string]string{"id": webhook.ID.String()}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	store.AssertNumberOfCalls(t, "UpdateWebhook", 1)
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	id := uuid.New()
+	store.On("DeleteWebhook", AnyContext(), id).Return(nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewWebhookHandler(store, nil).DeleteWebhook(rr, webhookRequest("DELETE", "", map[string]string{"id": id.String()}))
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	store.AssertExpectations(t)
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	id := uuid.New()
+	deliveries := []*models.WebhookDelivery{{ID: 7, WebhookID: id, EventType: "note.created", Status: models.DeliverySucceeded}}
+	store.On("ListDeliveries", AnyContext(), id, 50).Return(deliveries, nil).Once()
+	store.On("ListDeliveries", AnyContext(), id, 10).Return(deliveries, nil).Once()
+	handler := handlers.NewWebhookHandler(store, nil)
+	vars := map[string]string{"id": id.String()}
+
+	rr := httptest.NewRecorder()
+	handler.ListDeliveries(rr, webhookRequest("GET", "", vars))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"id":7`)
+
+	req := webhookRequest("GET", "", vars)
+	req.URL.RawQuery = "limit=10"
+	rr = httptest.NewRecorder()
+	handler.ListDeliveries(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	for _, limit := range []string{"0", "501", "ten"} {
+		req := webhookRequest("GET", "", vars)
+		req.URL.RawQuery = "limit=" + limit
+		rr := httptest.NewRecorder()
+		handler.ListDeliveries(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, limit)
+	}
+	store.AssertExpectations(t)
+}
+
+func TestRedeliverQueuesDelivery(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	webhook := storedWebhook()
+	store.On("GetWebhook", AnyContext(), webhook.ID).Return(webhook, nil)
+	store.On("Redeliver", AnyContext(), webhook.ID, int64(7)).Return(&models.WebhookDelivery{ID: 8, WebhookID: webhook.ID, Status: models.DeliveryPending}, nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewWebhookHandler(store, nil).Redeliver(rr, webhookRequest("POST", "", map[string]string{"id": webhook.ID.String(), "deliveryID": "7"}))
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"id":8`)
+	store.AssertExpectations(t)
+}
+
+func TestRedeliverToInactiveWebhookIsConflict(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+	webhook := storedWebhook()
+	webhook.Active = false
+	store.On("GetWebhook", AnyContext(), webhook.ID).Return(webhook, nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewWebhookHandler(store, nil).Redeliver(rr, webhookRequest("POST", "", map[string]string{"id": webhook.ID.String(), "deliveryID": "7"}))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var p problem.Problem
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, problem.CodeWebhookInactive, p.Code)
+	store.AssertNotCalled(t, "Redeliver", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRedeliverRejectsInvalidDeliveryID(t *testing.T) {
+	store := new(MockHandlerWebhookStore)
+
+	rr := httptest.NewRecorder()
+	handlers.NewWebhookHandler(store, nil).Redeliver(rr, webhookRequest("POST", "", map[string]string{"id": uuid.NewString(), "deliveryID": "x"}))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}